@@ -44,6 +44,7 @@ import (
 	"k8s.io/klog/v2"
 	cruntimeconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 
+	"github.com/mchudgins/go/helper"
 	"github.com/mchudgins/go/leader-election"
 	lew "github.com/mchudgins/go/leader-election/webapp"
 	"github.com/mchudgins/go/log"
@@ -55,6 +56,9 @@ import (
 const (
 	lockName       = "k8s-leader-example"
 	leaseNamespace = "default"
+
+	// shutdownTimeout bounds the wait for the background tasks & servers
+	shutdownTimeout = 30 * time.Second
 )
 
 var (
@@ -65,6 +69,12 @@ var (
 	httpPort = 8080
 	logLevel string
 
+	k8sAttempts = leader_election.DefaultBackoff.Attempts
+	k8sBackoff  = leader_election.DefaultBackoff.Initial
+
+	leaderReadiness bool
+	maxGoroutines   int
+
 	// ENV options
 	leaseName = "k8s-leader-example"
 )
@@ -107,58 +117,74 @@ to quickly create a Cobra application.`,
 		rnd := rand.New(rand.NewSource(runTime.UnixNano()))
 		_ = rnd
 
-		// Create a Kubernetes client using the current context
-		// recover from any panic from the OrDie attempts within
+		// a signal ends the startup retries, as well as the servers
+		ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+		defer stopSignals()
+
+		// Create a Kubernetes client using the current context, riding out
+		// a temporarily unavailable API server
+		backoff := leader_election.DefaultBackoff
+		backoff.Attempts = k8sAttempts
+		backoff.Initial = k8sBackoff
+
 		var clientset *kubernetes.Clientset
-		clientset = func(logger *zap.Logger) *kubernetes.Clientset {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("unable to obtain kubernetes client set")
-					clientset = nil
-				}
-			}()
-
-			clientset = kubernetes.NewForConfigOrDie(cruntimeconfig.GetConfigOrDie())
-
-			return clientset
-		}(logger)
-		if clientset == nil {
-			os.Exit(0)
+		err = leader_election.Retry(ctx, logger, "create kubernetes client", backoff, func() error {
+			config, err := cruntimeconfig.GetConfig()
+			if err != nil {
+				return err
+			}
+
+			clientset, err = kubernetes.NewForConfig(config)
+			return err
+		})
+		if ctx.Err() != nil {
+			logger.Info("OS Signal received during startup. Shutting down...")
+			return
+		}
+		if err != nil {
+			logger.Error("unable to obtain kubernetes client set", zap.Error(err))
+			os.Exit(1)
 		}
 		klog.SetLogger(zapr.NewLogger(logger)) // have the client-go library use the zap logger
 
-		// set up OS signals & waitgroups
-		sigs := make(chan os.Signal, 1) // Create channel to receive OS signals
-		stop := make(chan struct{})     // Create channel to receive stop signa
+		err = leader_election.Retry(ctx, logger, "read lease", backoff, func() error {
+			return leader_election.CheckLeaseAccess(ctx, clientset, namespace, leaseName)
+		})
+		if ctx.Err() != nil {
+			logger.Info("OS Signal received during startup. Shutting down...")
+			return
+		}
+		if err != nil {
+			logger.Error("unable to access the lease", zap.Error(err))
+			os.Exit(1)
+		}
+
+		// the webapp reports the leadership which MonitorLease records
+		weblogger := logger.With(zap.String("mod", "webapp"))
+		var webOptions []lew.Option
+		if leaderReadiness {
+			webOptions = append(webOptions, lew.WithLeaderReadiness())
+		}
+		if maxGoroutines > 0 {
+			webOptions = append(webOptions, lew.WithGoroutineThreshold(maxGoroutines))
+		}
+		s := lew.NewServer(weblogger, webOptions...)
 
-		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGINT) // Register the sigs channel to receive SIGTERM
+		// the lease monitor, pod watcher & servers run until a signal arrives
+		tasks := helper.NewTaskGroup(ctx, logger)
 
-		wg, err := leader_election.MonitorLease(logger, clientset, namespace, leaseName, podName)
-		if err != nil {
+		if err := leader_election.MonitorLease(logger, tasks, s.LeaderElection, clientset, namespace, leaseName, podName); err != nil {
 			logger.Fatal("unable to monitor lease",
 				zap.Error(err))
 		}
 
-		go func() {
-			for {
-				pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
-				if err != nil {
-					logger.Warn("unable to return list of pods",
-						zap.Error(err))
-				} else {
-					for _, v := range pods.Items {
-						logger.Info("pod", zap.String("name", v.Name))
-					}
-				}
-
-				time.Sleep(60 * time.Second)
-			}
-		}()
+		if err := leader_election.WatchPods(logger, tasks, clientset, namespace); err != nil {
+			logger.Warn("unable to watch pods",
+				zap.Error(err))
+		}
 
 		// start up the http & grpc servers
 
-		weblogger := logger.With(zap.String("mod", "webapp"))
-		s := lew.NewServer(weblogger)
 		options := server.OptionsFactory(
 			server.WithHTTPServer(s),
 			server.WithRPCUnaryInterceptors(grpcHelper.Recovery),
@@ -168,21 +194,31 @@ to quickly create a Cobra application.`,
 
 				return nil
 			}),
-			server.WithShutdownSignal(stop, wg),
 			server.WithHTTPListenPort(httpPort),
 			server.WithServiceName("leaderElection"),
 			server.WithLogger(weblogger),
 			server.WithGzip(),
 		)
 
-		// start the metrics, liveness, readiness server
-		server.Run(options...)
+		// start the metrics, liveness, readiness server; should the servers
+		// fail, the rest of the tasks are shut down as well
+		tasks.Go("servers", func(ctx context.Context) error {
+			if err := server.Run(append(options, server.WithShutdownContext(ctx))...); err != nil {
+				logger.Error("the servers have failed", zap.Error(err))
+			}
+			stopSignals()
+
+			return nil
+		})
 
-		<-sigs // Wait for signals (this hangs until a signal arrives)
+		<-ctx.Done() // Wait for signals (this hangs until a signal arrives)
 		logger.Info("OS Signal received. Shutting down...")
 
-		close(stop) // Tell goroutines to stop themselves
-		wg.Wait()   // Wait for all go routines to be stopped
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := tasks.Shutdown(shutdown); err != nil {
+			logger.Error("unable to stop the background tasks", zap.Error(err))
+		}
 	},
 }
 
@@ -202,6 +238,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level {'debug', 'info', 'warn', 'error'}")
 	rootCmd.PersistentFlags().BoolVarP(&fVerbose, "verbose", "v", false, "log additional details")
 	rootCmd.PersistentFlags().BoolVar(&asJSON, "json", false, "use JSON as log output format")
+	rootCmd.PersistentFlags().IntVar(&k8sAttempts, "k8s-attempts", k8sAttempts, "attempts to reach the kubernetes API server at startup")
+	rootCmd.PersistentFlags().DurationVar(&k8sBackoff, "k8s-backoff", k8sBackoff, "initial delay between attempts to reach the kubernetes API server")
+	rootCmd.PersistentFlags().IntVar(&maxGoroutines, "max-goroutines", leader_election.DefaultGoroutineThreshold, "fail the liveness check when more than this many goroutines are running")
+	rootCmd.PersistentFlags().BoolVar(&leaderReadiness, "leader-readiness", false, "report follower pods as not ready, so only the leader receives traffic")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package helper
+
+import (
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/mchudgins/go/log"
+)
+
+var panicsRecovered = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "panics_recovered_total",
+		Help: "Number of panics recovered by TrapPanics & TrapPanicsWithHandler.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(panicsRecovered)
+}
+
+// TrapPanics, when deferred, recovers a panic in the calling goroutine and
+// logs it, along with the panicking stack, rather than crashing the process
+func TrapPanics(logger *zap.Logger, name string) {
+	if r := recover(); r != nil {
+		trapped(logger, r, debug.Stack(), zap.String("task", name))
+	}
+}
+
+// TrapPanicsWithHandler, when deferred, recovers and logs a panic as
+// TrapPanics does, then calls fn with the recovered value and the
+// panicking stack, e.g., to fail a health check or to clean up
+func TrapPanicsWithHandler(logger *zap.Logger, fn func(recovered interface{}, stack []byte)) {
+	if r := recover(); r != nil {
+		stack := debug.Stack()
+		trapped(logger, r, stack)
+		fn(r, stack)
+	}
+}
+
+// trapped counts & logs a recovered panic.  recover must be called by the
+// deferred function itself, so each Trap func calls it & then trapped.
+func trapped(logger *zap.Logger, recovered interface{}, stack []byte, fields ...zap.Field) {
+	panicsRecovered.Inc()
+
+	logger.Error("panic occurred",
+		append(fields, log.PanicFields(recovered, stack, log.DefaultPanicFrames)...)...)
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package helper
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func panicsRecoveredCount(t *testing.T) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() == "panics_recovered_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
+
+func TestTrapPanicsWithHandler(t *testing.T) {
+	before := panicsRecoveredCount(t)
+
+	var recovered interface{}
+	var stack []byte
+	func() {
+		defer TrapPanicsWithHandler(zap.NewNop(), func(r interface{}, s []byte) {
+			recovered, stack = r, s
+		})
+		panic("boom")
+	}()
+
+	assert.Equal(t, "boom", recovered)
+	assert.Contains(t, string(stack), "TestTrapPanicsWithHandler")
+
+	func() {
+		defer TrapPanics(zap.NewNop(), "test")
+		panic("again")
+	}()
+	assert.Equal(t, before+2, panicsRecoveredCount(t))
+
+	// without a panic, neither the handler nor the counter is touched
+	func() {
+		defer TrapPanicsWithHandler(zap.NewNop(), func(interface{}, []byte) { t.Error("handler called without a panic") })
+	}()
+	assert.Equal(t, before+2, panicsRecoveredCount(t))
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+// Package helper provides utilities for managing the lifecycle of a service
+package helper
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var tasksRunning = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "background_tasks_running",
+		Help: "Number of background tasks running, by task name.",
+	},
+	[]string{"task"},
+)
+
+func init() {
+	prometheus.MustRegister(tasksRunning)
+}
+
+// TaskGroup manages named, long-running background tasks, e.g., watchers
+// and tickers, which share a context that is cancelled by Shutdown
+type TaskGroup struct {
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	running  map[string]int
+	shutdown bool
+}
+
+// NewTaskGroup returns a TaskGroup whose tasks' context is derived from parent
+func NewTaskGroup(parent context.Context, logger *zap.Logger) *TaskGroup {
+	ctx, cancel := context.WithCancel(parent)
+
+	return &TaskGroup{
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+}
+
+// Context returns the context shared by the tasks, which is cancelled
+// when the TaskGroup shuts down
+func (g *TaskGroup) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a new goroutine.  fn should return when its context is
+// cancelled; an error it returns, or a panic, is logged, but doesn't
+// affect the other tasks.  Tasks started after Shutdown are not run.
+func (g *TaskGroup) Go(name string, fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.shutdown {
+		g.logger.Warn("task not started; the task group has shut down", zap.String("task", name))
+		return
+	}
+
+	g.running[name]++
+	tasksRunning.WithLabelValues(name).Inc()
+	g.wg.Add(1)
+
+	go func() {
+		defer g.done(name)
+		defer TrapPanics(g.logger, name)
+
+		g.logger.Debug("task started", zap.String("task", name))
+		if err := fn(g.ctx); err != nil && g.ctx.Err() == nil {
+			g.logger.Error("task failed", zap.String("task", name), zap.Error(err))
+			return
+		}
+		g.logger.Debug("task stopped", zap.String("task", name))
+	}()
+}
+
+func (g *TaskGroup) done(name string) {
+	g.mu.Lock()
+	if g.running[name]--; g.running[name] == 0 {
+		delete(g.running, name)
+	}
+	g.mu.Unlock()
+
+	tasksRunning.WithLabelValues(name).Dec()
+	g.wg.Done()
+}
+
+// Running returns the names of the tasks which have yet to return
+func (g *TaskGroup) Running() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	names := make([]string, 0, len(g.running))
+	for name := range g.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Shutdown cancels the tasks' context and waits for them to return or for
+// ctx to be done, whichever is first.  If ctx is done first, the tasks
+// still running are logged and ctx.Err() is returned.
+func (g *TaskGroup) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.shutdown = true
+	g.mu.Unlock()
+
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		g.logger.Warn("background tasks did not stop in time",
+			zap.Strings("tasks", g.Running()))
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package helper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTaskGroupShutdown(t *testing.T) {
+	g := NewTaskGroup(context.Background(), zap.NewNop())
+
+	stopped := make(chan struct{})
+	g.Go("ticker", func(ctx context.Context) error {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+	g.Go("panics", func(ctx context.Context) error { panic("boom") })
+	g.Go("fails", func(ctx context.Context) error { return errors.New("failed") })
+
+	assert.Eventually(t, func() bool { return len(g.Running()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"ticker"}, g.Running())
+
+	assert.NoError(t, g.Shutdown(context.Background()))
+	<-stopped
+	assert.Empty(t, g.Running())
+
+	// tasks started after shutdown never run
+	g.Go("late", func(ctx context.Context) error {
+		t.Error("task started after shutdown")
+		return nil
+	})
+}
+
+func TestTaskGroupShutdownTimeout(t *testing.T) {
+	g := NewTaskGroup(context.Background(), zap.NewNop())
+
+	release := make(chan struct{})
+	g.Go("stubborn", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, g.Shutdown(ctx))
+	assert.Equal(t, []string{"stubborn"}, g.Running())
+
+	close(release)
+	assert.NoError(t, g.Shutdown(context.Background()))
+}
@@ -29,10 +29,26 @@ import (
 	"github.com/mchudgins/go/net/server/healthcheck"
 )
 
-func HealthCheckAPI() http.Handler {
+// DefaultGoroutineThreshold is the number of goroutines above which the
+// liveness check fails, unless HealthCheckAPI is given another threshold
+const DefaultGoroutineThreshold = 25
+
+// HealthCheckAPI serves the liveness & readiness checks.  If requireLeader
+// is true, follower pods report not-ready, so that only the leader receives
+// traffic; otherwise followers remain ready, e.g., to serve reads.  The
+// liveness check fails when more than goroutineThreshold goroutines are
+// running; zero selects DefaultGoroutineThreshold.
+func HealthCheckAPI(le *LeaderElection, requireLeader bool, goroutineThreshold int) http.Handler {
 	h := healthcheck.NewHandler()
 
-	h.AddLivenessCheck("goroutine-threshold", healthcheck.GoroutineCountCheck(25))
+	if goroutineThreshold <= 0 {
+		goroutineThreshold = DefaultGoroutineThreshold
+	}
+	h.AddLivenessCheck("goroutine-threshold", healthcheck.GoroutineCountCheck(goroutineThreshold))
+
+	if requireLeader {
+		h.AddReadinessCheck("leader", le.ReadinessCheck())
+	}
 
 	return h
 }
@@ -23,4 +23,80 @@
 
 package leader_election
 
-type LeaderElection struct{}
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mchudgins/go/log"
+)
+
+// ErrNotLeader is reported by the leader readiness check on follower pods
+var ErrNotLeader = errors.New("this pod is not the leader")
+
+// LeaderElection tracks whether this pod currently holds the lease
+type LeaderElection struct {
+	leader atomic.Bool
+}
+
+// IsLeader reports whether this pod is the current leader
+func (le *LeaderElection) IsLeader() bool {
+	return le.leader.Load()
+}
+
+// SetLeader records a change of leadership, e.g., from the elector's
+// OnStartedLeading & OnStoppedLeading callbacks
+func (le *LeaderElection) SetLeader(leader bool) {
+	le.leader.Store(leader)
+}
+
+// ReadinessCheck returns a check which fails unless this pod is the
+// leader, so that a Service selects only the leader
+func (le *LeaderElection) ReadinessCheck() func(context.Context) error {
+	return func(context.Context) error {
+		if !le.IsLeader() {
+			return ErrNotLeader
+		}
+		return nil
+	}
+}
+
+// OnStartedLeading is the elector's OnStartedLeading callback.  It records
+// this pod as the leader and, until ctx is done, periodically logs that it
+// still is.
+func (le *LeaderElection) OnStartedLeading(ctx context.Context) {
+	le.SetLeader(true)
+
+	logger := log.FromContext(ctx)
+	hostname := os.Getenv("POD_NAME")
+
+	logger.Info("leading",
+		zap.String("podName", hostname))
+
+	// do initial stuff here to assume leadership....
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("stopped leader loop",
+					zap.String("podName", hostname))
+				return
+
+			case <-time.After(3 * time.Second):
+				logger.Info("still the leader",
+					zap.String("podName", hostname))
+			}
+		}
+	}()
+}
+
+// OnStoppedLeading is the elector's OnStoppedLeading callback, which
+// records that this pod is no longer the leader
+func (le *LeaderElection) OnStoppedLeading() {
+	le.SetLeader(false)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package leader_election
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeadershipCallbacks(t *testing.T) {
+	le := &LeaderElection{}
+	h := HealthCheckAPI(le, true, 1000)
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz/ready", nil))
+		return rr.Code
+	}
+
+	assert.False(t, le.IsLeader())
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	le.OnStartedLeading(ctx)
+	assert.True(t, le.IsLeader())
+	assert.NoError(t, le.ReadinessCheck()(ctx))
+	assert.Equal(t, http.StatusOK, ready())
+
+	// the elector cancels the context, then calls OnStoppedLeading
+	cancel()
+	le.OnStoppedLeading()
+	assert.False(t, le.IsLeader())
+	assert.ErrorIs(t, le.ReadinessCheck()(context.Background()), ErrNotLeader)
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+}
@@ -25,13 +25,13 @@ package leader_election
 
 import (
 	"context"
-	"os"
-	"sync"
 	"time"
 
+	"github.com/mchudgins/go/helper"
 	"github.com/mchudgins/go/log"
 
 	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -39,7 +39,9 @@ import (
 )
 import "k8s.io/client-go/tools/leaderelection"
 
-func MonitorLease(logger *zap.Logger, clientset *kubernetes.Clientset, namespace, leaseName, hostname string) (*sync.WaitGroup, error) {
+// MonitorLease campaigns for the lease, recording in le whether this pod
+// holds it, until tasks shuts down, when the lease is released
+func MonitorLease(logger *zap.Logger, tasks *helper.TaskGroup, le *LeaderElection, clientset *kubernetes.Clientset, namespace, leaseName, hostname string) error {
 	leaderElectionConfig := leaderelection.LeaderElectionConfig{
 		Lock: &resourcelock.LeaseLock{
 			LeaseMeta: metav1.ObjectMeta{
@@ -55,8 +57,9 @@ func MonitorLease(logger *zap.Logger, clientset *kubernetes.Clientset, namespace
 		RenewDeadline: 10 * time.Second,
 		RetryPeriod:   5 * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: onStartedLeading,
+			OnStartedLeading: le.OnStartedLeading,
 			OnStoppedLeading: func() {
+				le.OnStoppedLeading()
 				logger.Info("no longer the leader")
 			},
 			OnNewLeader: func(identity string) {
@@ -73,50 +76,30 @@ func MonitorLease(logger *zap.Logger, clientset *kubernetes.Clientset, namespace
 			zap.Error(err))
 	}
 
-	ctx, _ := context.WithCancel(context.Background())
-	//	defer cancel()
-
-	ctx = log.NewContext(ctx, logger.With(zap.String("goRoutine", "MonitorLease")))
-
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
+	tasks.Go("monitorLease", func(ctx context.Context) error {
+		ctx = log.NewContext(ctx, logger.With(zap.String("goRoutine", "MonitorLease")))
 
 		leaderelection.RunOrDie(ctx, leaderElectionConfig)
-		logger.Warn("leaderelection.RunOrDie has returned!")
-	}()
-
-	return wg, nil
-}
-
-func onStartedLeading(ctx context.Context) {
-	logger := log.FromContext(ctx)
-
-	hostname := os.Getenv("POD_NAME")
-
-	logger.Info("leading",
-		zap.String("podName", hostname))
-
-	// do initial stuff here to assume leadership....
+		if ctx.Err() == nil {
+			logger.Warn("leaderelection.RunOrDie has returned!")
+		}
 
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("stopped leader loop",
-					zap.String("podName", hostname))
+		return nil
+	})
 
-			default:
-				logger.Info("still the leader",
-					zap.String("podName", hostname))
+	return nil
+}
 
-				time.Sleep(3 * time.Second)
-			}
-		}
-	}()
+// CheckLeaseAccess verifies that the lease can be read from the API
+// server.  A lease which does not exist yet is not an error, as it is
+// created when first acquired.
+func CheckLeaseAccess(ctx context.Context, clientset *kubernetes.Clientset, namespace, leaseName string) error {
+	_, err := clientset.CoordinationV1().Leases(namespace).Get(ctx, leaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
 
+	return err
 }
 
 func getKubeClient() (*kubernetes.Clientset, error) {
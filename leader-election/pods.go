@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package leader_election
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mchudgins/go/helper"
+)
+
+// podSyncWarning is how long WatchPods waits for the initial list of pods
+// before warning that it has not been received
+const podSyncWarning = 30 * time.Second
+
+// WatchPods logs the pods of namespace as they are added, change phase
+// or are deleted, until tasks shuts down.  The informer runs as a task; the
+// initial list of pods is awaited in the background, so that, e.g., a
+// missing list or watch permission does not hold up startup.
+func WatchPods(logger *zap.Logger, tasks *helper.TaskGroup, clientset *kubernetes.Clientset, namespace string) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	_, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				logger.Info("pod added",
+					zap.String("name", pod.Name),
+					zap.String("phase", string(pod.Status.Phase)))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*corev1.Pod)
+			if !ok || old.Status.Phase == pod.Status.Phase {
+				return
+			}
+
+			logger.Info("pod changed phase",
+				zap.String("name", pod.Name),
+				zap.String("from", string(old.Status.Phase)),
+				zap.String("to", string(pod.Status.Phase)))
+		},
+		DeleteFunc: func(obj interface{}) {
+			// the final state of the pod may be unknown if the watch missed the deletion
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				logger.Info("pod deleted", zap.String("name", pod.Name))
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	tasks.Go("watchPods", func(ctx context.Context) error {
+		factory.Start(ctx.Done())
+		defer factory.Shutdown()
+
+		warning := time.AfterFunc(podSyncWarning, func() {
+			logger.Warn("the pods have not been listed yet -- can the service account list & watch pods?",
+				zap.String("namespace", namespace))
+		})
+		synced := cache.WaitForCacheSync(ctx.Done(), podInformer.HasSynced)
+		warning.Stop()
+		if synced {
+			logger.Info("watching pods", zap.String("namespace", namespace))
+		}
+
+		<-ctx.Done()
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package leader_election
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff bounds the retries of an operation
+type Backoff struct {
+	Attempts int           // the maximum number of attempts
+	Initial  time.Duration // the delay after the first failed attempt
+	Max      time.Duration // the limit of the delay, which doubles after each failure
+}
+
+// DefaultBackoff rides out a control-plane blip of about a minute
+var DefaultBackoff = Backoff{
+	Attempts: 6,
+	Initial:  2 * time.Second,
+	Max:      30 * time.Second,
+}
+
+// Retry calls fn until it succeeds, it has been attempted b.Attempts
+// times, or ctx is done, logging each failed attempt.  It returns the
+// error from the final attempt.
+func Retry(ctx context.Context, logger *zap.Logger, operation string, b Backoff, fn func() error) error {
+	delay := b.Initial
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if attempt >= b.Attempts {
+			logger.Error("giving up",
+				zap.String("operation", operation),
+				zap.Int("attempt", attempt),
+				zap.Error(err))
+			return err
+		}
+
+		logger.Warn("attempt failed; retrying",
+			zap.String("operation", operation),
+			zap.Int("attempt", attempt),
+			zap.Duration("retryIn", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if b.Max > 0 && delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package leader_election
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRetryBacksOff(t *testing.T) {
+	var calls []time.Time
+	b := Backoff{Attempts: 5, Initial: 10 * time.Millisecond, Max: 25 * time.Millisecond}
+
+	err := Retry(context.Background(), zap.NewNop(), "test", b, func() error {
+		calls = append(calls, time.Now())
+		if len(calls) < 4 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	if !assert.Len(t, calls, 4) {
+		return
+	}
+
+	// the delay doubles after each failure, up to Max
+	for i, least := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond} {
+		assert.GreaterOrEqual(t, calls[i+1].Sub(calls[i]), least, "delay after attempt %d", i+1)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts := 0
+	b := Backoff{Attempts: 3, Initial: time.Millisecond}
+
+	err := Retry(context.Background(), zap.NewNop(), "test", b, func() error {
+		attempts++
+		return errors.New("attempt failed")
+	})
+	assert.EqualError(t, err, "attempt failed")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	b := Backoff{Attempts: 3, Initial: time.Hour}
+
+	done := make(chan error)
+	go func() {
+		done <- Retry(ctx, zap.NewNop(), "test", b, func() error {
+			attempts++
+			return errors.New("unavailable")
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "unavailable")
+		assert.Equal(t, 1, attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry did not return once its context was cancelled")
+	}
+}
@@ -24,74 +24,50 @@
 package webapp
 
 import (
-	"github.com/justinas/alice"
-	leader_election "github.com/mchudgins/go/leader-election"
-	"github.com/mchudgins/go/log"
-	"github.com/mchudgins/go/net/server/correlationID"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 	"net/http"
-)
 
-func (s *WebApp) routes() {
-	//	s.router.NotFoundHandler = notFoundHandler()
-	//	s.router.MethodNotAllowedHandler = methodNotAllowedHandler()
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	s.chain = s.chain.Append(s.contextLogger(), rateLimit(10, 50))
+	leader_election "github.com/mchudgins/go/leader-election"
+	gsh "github.com/mchudgins/go/net/server/handler"
+	gsw "github.com/mchudgins/go/net/server/webapp"
+)
+
+func (s *WebApp) routes(b *gsw.Base) {
+	b.Use(gsw.RateLimit(10, 50))
 
 	// health checks
 
-	s.router.Handle(
+	b.HandleNamed(
+		"health checks",
 		"GET /healthz/",
-		leader_election.HealthCheckAPI(),
+		leader_election.HealthCheckAPI(s.LeaderElection, s.requireLeader, s.maxGoroutines),
+	)
+
+	// 200 on the leader, 503 elsewhere, regardless of WithLeaderReadiness
+	b.HandleNamed(
+		"leader status",
+		"GET /leader",
+		http.HandlerFunc(s.leaderStatus),
 	)
 
 	// make prom metrics available
-	s.router.Handle(
+	b.HandleNamed(
+		"prometheus metrics handler",
 		"GET /metrics",
 		promhttp.Handler(),
 	)
 }
 
-// contextLogger adds the per-request fields we care about to each log message
-func (s *WebApp) contextLogger() alice.Constructor {
-	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-			ctxLogger := s.logger.With(zap.String(correlationID.RequestIDKey, correlationID.FromContext(ctx)))
+func (s *WebApp) leaderStatus(w http.ResponseWriter, r *http.Request) {
+	leader := s.LeaderElection.IsLeader()
 
-			ctx = log.NewContext(ctx, ctxLogger)
-			r = r.WithContext(ctx)
-
-			h.ServeHTTP(w, r)
-		})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !leader {
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
-}
-
-func rateLimit(limit rate.Limit, burst int) alice.Constructor {
-	rl := rate.NewLimiter(limit, burst)
-	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if rl.Allow() {
-				h.ServeHTTP(w, r)
-			} else {
-				w.WriteHeader(http.StatusTooManyRequests)
-			}
-		})
-	}
-}
 
-// notFoundHandler
-func notFoundHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-	}
-}
-
-// methodNotAllowedHandler
-func methodNotAllowedHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-	}
+	_ = gsh.EncodeJSON(w, r, struct {
+		Leader bool `json:"leader"`
+	}{leader}, false)
 }
@@ -24,36 +24,45 @@
 package webapp
 
 import (
-	"net/http"
-
-	"github.com/justinas/alice"
 	"go.uber.org/zap"
 
 	leader_election "github.com/mchudgins/go/leader-election"
+	gsw "github.com/mchudgins/go/net/server/webapp"
 )
 
 type WebApp struct {
-	logger         *zap.Logger
-	router         *http.ServeMux
-	chain          alice.Chain
+	*gsw.Base
 	LeaderElection *leader_election.LeaderElection
+	requireLeader  bool
+	maxGoroutines  int
 }
 
-func NewServer(logger *zap.Logger) *WebApp {
+// Option customizes the WebApp
+type Option func(s *WebApp)
+
+// WithLeaderReadiness reports follower pods as not ready, so that a
+// Service routes only to the leader.  By default, followers are ready.
+func WithLeaderReadiness() Option {
+	return func(s *WebApp) { s.requireLeader = true }
+}
+
+// WithGoroutineThreshold fails the liveness check when more than n
+// goroutines are running.  By default, the threshold is
+// leader_election.DefaultGoroutineThreshold.
+func WithGoroutineThreshold(n int) Option {
+	return func(s *WebApp) { s.maxGoroutines = n }
+}
+
+func NewServer(logger *zap.Logger, options ...Option) *WebApp {
 	s := &WebApp{
-		logger:         logger,
-		router:         http.NewServeMux(),
-		chain:          alice.New(),
 		LeaderElection: &leader_election.LeaderElection{},
 	}
 
-	s.routes()
+	for _, option := range options {
+		option(s)
+	}
 
-	s.chain.Then(s)
+	s.Base = gsw.NewBase(logger, s.routes)
 
 	return s
 }
-
-func (s *WebApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.router.ServeHTTP(w, r)
-}
@@ -83,6 +83,23 @@ func GetLambdaLogger(lambdaName string) *zap.Logger {
 
 // GetCmdLogger returns a zap.Logger suitable for non-lambda processes
 func GetCmdLogger(cmdName, logLevel string, asJSON bool) *zap.Logger {
+	config := cmdLoggerConfig(cmdName, logLevel, asJSON)
+
+	//	config := log.NewDevelopmentConfig()
+	//	config.EncoderConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+	logger, err := config.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	// add metrics
+	logger = logger.WithOptions(zap.Hooks(PrometheusMetrics))
+
+	return logger //.With(log.String("x-request-id", "01234"))
+}
+
+// cmdLoggerConfig returns the configuration of the GetCmdLogger loggers
+func cmdLoggerConfig(cmdName, logLevel string, asJSON bool) *zap.Config {
 	// See the documentation for Config and zapcore.EncoderConfig for all the
 	// available options.
 	rawJSON := []byte(`{
@@ -121,19 +138,7 @@ func GetCmdLogger(cmdName, logLevel string, asJSON bool) *zap.Logger {
 		config.InitialFields["cmd"] = cmdName
 	}
 
-	config = SetLogLevel(config, logLevel)
-
-	//	config := log.NewDevelopmentConfig()
-	//	config.EncoderConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
-	logger, err := config.Build()
-	if err != nil {
-		panic(err)
-	}
-
-	// add metrics
-	logger = logger.WithOptions(zap.Hooks(PrometheusMetrics))
-
-	return logger //.With(log.String("x-request-id", "01234"))
+	return SetLogLevel(config, logLevel)
 }
 
 func SetLogLevel(config *zap.Config, level string) *zap.Config {
@@ -53,6 +53,18 @@ var (
 			Help: "Number of error messages logged.",
 		},
 	)
+	otlpDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "logging_otlp_dropped_total",
+			Help: "Number of log entries not exported via OTLP because the export queue was full.",
+		},
+	)
+	otlpExportFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "logging_otlp_export_failures_total",
+			Help: "Number of batches of log entries which could not be exported via OTLP.",
+		},
+	)
 )
 
 func PrometheusMetrics(e zapcore.Entry) error {
@@ -80,4 +92,6 @@ func init() {
 	prometheus.MustRegister(infoMsgCount)
 	prometheus.MustRegister(warnMsgCount)
 	prometheus.MustRegister(errorMsgCount)
+	prometheus.MustRegister(otlpDropped)
+	prometheus.MustRegister(otlpExportFailures)
 }
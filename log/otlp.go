@@ -0,0 +1,384 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// OTLPEndpoint & OTLPLogsEndpoint are the standard environment variables
+	// naming the collector, used when GetCmdLoggerOTLP is given no endpoint
+	OTLPEndpoint     = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	OTLPLogsEndpoint = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+
+	otlpDefaultEndpoint = "http://localhost:4318"
+	otlpLogsPath        = "/v1/logs"
+	otlpScope           = "github.com/mchudgins/go/log"
+
+	otlpBatchSize     = 512
+	otlpQueueSize     = 4096
+	otlpFlushInterval = time.Second
+	otlpTimeout       = 5 * time.Second
+)
+
+// GetCmdLoggerOTLP returns a GetCmdLogger logger which, in addition to
+// writing to stdout, exports each entry to an OpenTelemetry collector via
+// OTLP/HTTP (JSON encoding) at endpoint, e.g., "http://collector:4318".  If
+// endpoint is empty, the OTEL_EXPORTER_OTLP_LOGS_ENDPOINT or
+// OTEL_EXPORTER_OTLP_ENDPOINT environment variables name the collector.
+// Entries are exported in batches; Sync exports any pending entries.  If
+// the collector falls behind, entries are dropped from the export (but
+// not from stdout) and counted in logging_otlp_dropped_total.
+func GetCmdLoggerOTLP(cmdName, logLevel string, asJSON bool, endpoint string) *zap.Logger {
+	config := cmdLoggerConfig(cmdName, logLevel, asJSON)
+
+	exporter := newOTLPExporter(otlpLogsURL(endpoint), cmdName)
+	logger, err := config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &otlpCore{LevelEnabler: config.Level, exporter: exporter})
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	// add metrics
+	logger = logger.WithOptions(zap.Hooks(PrometheusMetrics))
+
+	return logger
+}
+
+// otlpLogsURL returns the URL to which logs are posted
+func otlpLogsURL(endpoint string) string {
+	if len(endpoint) == 0 {
+		if logs := os.Getenv(OTLPLogsEndpoint); len(logs) > 0 {
+			return logs // used as-is, per the specification
+		}
+		endpoint = os.Getenv(OTLPEndpoint)
+	}
+	if len(endpoint) == 0 {
+		endpoint = otlpDefaultEndpoint
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	if !strings.HasSuffix(endpoint, otlpLogsPath) {
+		endpoint = strings.TrimSuffix(endpoint, "/") + otlpLogsPath
+	}
+
+	return endpoint
+}
+
+// otlpCore is a zapcore.Core which converts entries to OTLP log records
+type otlpCore struct {
+	zapcore.LevelEnabler
+	exporter *otlpExporter
+	fields   []zapcore.Field
+}
+
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append(make([]zapcore.Field, 0, len(c.fields)+len(fields)), c.fields...), fields...)
+	return &clone
+}
+
+func (c *otlpCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *otlpCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if len(e.LoggerName) > 0 {
+		enc.AddString("logger", e.LoggerName)
+	}
+	if len(e.Stack) > 0 {
+		enc.AddString("exception.stacktrace", e.Stack)
+	}
+
+	message := e.Message
+	c.exporter.enqueue(otlpLogRecord{
+		TimeUnixNano:   strconv.FormatInt(e.Time.UnixNano(), 10),
+		SeverityNumber: otlpSeverity(e.Level),
+		SeverityText:   e.Level.CapitalString(),
+		Body:           otlpValue{StringValue: &message},
+		Attributes:     otlpAttributes(enc.Fields),
+	})
+
+	// the process is about to panic or exit, so export the entry now
+	if e.Level > zapcore.ErrorLevel {
+		return c.exporter.flush()
+	}
+
+	return nil
+}
+
+func (c *otlpCore) Sync() error {
+	return c.exporter.flush()
+}
+
+// otlpSeverity maps a zap level to an OTLP severity number
+func otlpSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 5
+	case zapcore.InfoLevel:
+		return 9
+	case zapcore.WarnLevel:
+		return 13
+	case zapcore.ErrorLevel:
+		return 17
+	case zapcore.DPanicLevel:
+		return 19
+	default: // panic & fatal
+		return 21
+	}
+}
+
+// the OTLP/HTTP JSON encoding of the logs service request
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64s are strings in the JSON mapping
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpValue      `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+// otlpAttributes converts the fields of a MapObjectEncoder to attributes
+func otlpAttributes(fields map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: newOTLPValue(fields[k])})
+	}
+
+	return attrs
+}
+
+func newOTLPValue(v interface{}) otlpValue {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
+		s = fmt.Sprint(v)
+		return otlpValue{IntValue: &s}
+	case float32:
+		f := float64(v)
+		return otlpValue{DoubleValue: &f}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case time.Duration:
+		s = v.String()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		// arrays & objects are exported as their JSON
+		if b, err := json.Marshal(v); err == nil {
+			s = string(b)
+		} else {
+			s = fmt.Sprint(v)
+		}
+	}
+
+	return otlpValue{StringValue: &s}
+}
+
+// otlpExporter posts batches of log records to the collector from
+// a single go routine, which lives as long as the process
+type otlpExporter struct {
+	url      string
+	client   *http.Client
+	service  string
+	queue    chan otlpLogRecord
+	flushReq chan chan error
+}
+
+func newOTLPExporter(url, service string) *otlpExporter {
+	e := &otlpExporter{
+		url:      url,
+		client:   &http.Client{Timeout: otlpTimeout},
+		service:  service,
+		queue:    make(chan otlpLogRecord, otlpQueueSize),
+		flushReq: make(chan chan error),
+	}
+	go e.run()
+
+	return e
+}
+
+// enqueue queues r for export, dropping it if the queue is full, since
+// logging must never block on the collector
+func (e *otlpExporter) enqueue(r otlpLogRecord) {
+	select {
+	case e.queue <- r:
+	default:
+		otlpDropped.Inc()
+	}
+}
+
+// flush exports the queued records
+func (e *otlpExporter) flush() error {
+	done := make(chan error, 1)
+	e.flushReq <- done
+	return <-done
+}
+
+func (e *otlpExporter) run() {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]otlpLogRecord, 0, otlpBatchSize)
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := e.send(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case r := <-e.queue:
+			batch = append(batch, r)
+			if len(batch) >= otlpBatchSize {
+				_ = send()
+			}
+
+		case <-ticker.C:
+			_ = send()
+
+		case done := <-e.flushReq:
+			var err error
+			for pending := true; pending; {
+				select {
+				case r := <-e.queue:
+					batch = append(batch, r)
+					if len(batch) >= otlpBatchSize {
+						err = send()
+					}
+				default:
+					pending = false
+				}
+			}
+			if sendErr := send(); sendErr != nil {
+				err = sendErr
+			}
+			done <- err
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []otlpLogRecord) error {
+	var body otlpRequest
+	body.ResourceLogs = []otlpResourceLogs{{}}
+	rl := &body.ResourceLogs[0]
+
+	service := e.service
+	rl.Resource.Attributes = []otlpKeyValue{{Key: "service.name", Value: otlpValue{StringValue: &service}}}
+	rl.ScopeLogs = []otlpScopeLogs{{LogRecords: batch}}
+	rl.ScopeLogs[0].Scope.Name = otlpScope
+
+	b, err := json.Marshal(&body)
+	if err != nil {
+		otlpExportFailures.Inc()
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		otlpExportFailures.Inc()
+		return fmt.Errorf("exporting logs to %s: %w", e.url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		otlpExportFailures.Inc()
+		return fmt.Errorf("exporting logs to %s: status %d", e.url, resp.StatusCode)
+	}
+
+	return nil
+}
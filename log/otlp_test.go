@@ -0,0 +1,193 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// collector is an OTLP/HTTP collector which records the requests posted
+type collector struct {
+	*httptest.Server
+	status int
+
+	mu       sync.Mutex
+	requests []otlpRequest
+}
+
+func newCollector(t *testing.T, status int) *collector {
+	c := &collector{status: status}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlpLogsPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		c.mu.Lock()
+		c.requests = append(c.requests, req)
+		c.mu.Unlock()
+
+		w.WriteHeader(c.status)
+	}))
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+// records returns the log records received, and the size of each batch
+func (c *collector) records() ([]otlpLogRecord, []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var records []otlpLogRecord
+	var batches []int
+	for _, req := range c.requests {
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				records = append(records, sl.LogRecords...)
+				batches = append(batches, len(sl.LogRecords))
+			}
+		}
+	}
+
+	return records, batches
+}
+
+func newOTLPLogger(c *collector) *zap.Logger {
+	exporter := newOTLPExporter(otlpLogsURL(c.URL), "otlp-test")
+	return zap.New(&otlpCore{LevelEnabler: zapcore.DebugLevel, exporter: exporter})
+}
+
+func counterValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
+
+func TestOTLPEncoding(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	logger := newOTLPLogger(c).Named("orders").With(zap.String("region", "east"))
+
+	logger.Warn("slow request", zap.Int("attempt", 3), zap.Bool("retried", true), zap.Float64("ratio", 0.5))
+	assert.NoError(t, logger.Sync())
+
+	c.mu.Lock()
+	if assert.Len(t, c.requests, 1) {
+		rl := c.requests[0].ResourceLogs[0]
+		assert.Equal(t, "service.name", rl.Resource.Attributes[0].Key)
+		assert.Equal(t, "otlp-test", *rl.Resource.Attributes[0].Value.StringValue)
+		assert.Equal(t, otlpScope, rl.ScopeLogs[0].Scope.Name)
+	}
+	c.mu.Unlock()
+
+	records, _ := c.records()
+	if !assert.Len(t, records, 1) {
+		return
+	}
+	r := records[0]
+	assert.Equal(t, "slow request", *r.Body.StringValue)
+	assert.Equal(t, 13, r.SeverityNumber)
+	assert.Equal(t, "WARN", r.SeverityText)
+	assert.NotEmpty(t, r.TimeUnixNano)
+
+	attrs := make(map[string]otlpValue)
+	for _, kv := range r.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "orders", *attrs["logger"].StringValue)
+	assert.Equal(t, "east", *attrs["region"].StringValue)
+	assert.Equal(t, "3", *attrs["attempt"].IntValue)
+	assert.True(t, *attrs["retried"].BoolValue)
+	assert.Equal(t, 0.5, *attrs["ratio"].DoubleValue)
+}
+
+func TestOTLPBatching(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	logger := newOTLPLogger(c)
+
+	const n = 2*otlpBatchSize + 1
+	for i := 0; i < n; i++ {
+		logger.Info("entry", zap.Int("i", i))
+	}
+	assert.NoError(t, logger.Sync())
+
+	records, batches := c.records()
+	assert.Len(t, records, n)
+	assert.GreaterOrEqual(t, len(batches), 3)
+	for _, size := range batches {
+		assert.LessOrEqual(t, size, otlpBatchSize)
+	}
+}
+
+func TestOTLPDropsWhenQueueIsFull(t *testing.T) {
+	// without its go routine, nothing drains the exporter's queue
+	exporter := &otlpExporter{queue: make(chan otlpLogRecord, 1)}
+
+	before := counterValue(t, "logging_otlp_dropped_total")
+	exporter.enqueue(otlpLogRecord{})
+	exporter.enqueue(otlpLogRecord{})
+	assert.Equal(t, before+1, counterValue(t, "logging_otlp_dropped_total"))
+}
+
+func TestOTLPFlushesBeforePanic(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	logger := newOTLPLogger(c)
+
+	logger.Error("not yet exported")
+	assert.Panics(t, func() { logger.Panic("exported at once") })
+
+	// the panic entry, & the entries queued before it, were exported without a Sync
+	records, _ := c.records()
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "exported at once", *records[1].Body.StringValue)
+		assert.Equal(t, 21, records[1].SeverityNumber)
+	}
+}
+
+func TestOTLPExportFailure(t *testing.T) {
+	c := newCollector(t, http.StatusServiceUnavailable)
+	logger := newOTLPLogger(c)
+
+	before := counterValue(t, "logging_otlp_export_failures_total")
+	logger.Info("rejected")
+	assert.Error(t, logger.Sync())
+	assert.Equal(t, before+1, counterValue(t, "logging_otlp_export_failures_total"))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DefaultPanicFrames is the number of stack frames logged for a recovered
+// panic, e.g., by grpcHelper.Recovery
+const DefaultPanicFrames = 32
+
+// PanicFields returns the fields used to log a recovered panic: the
+// panic value and its type, the goroutine ID and the stack, as a single
+// multi-line string limited to maxFrames frames (all, if maxFrames <= 0).
+// stack is the output of debug.Stack().
+func PanicFields(recovered interface{}, stack []byte, maxFrames int) []zap.Field {
+	goroutine, frames := parseStack(string(stack))
+
+	trace := frames
+	if maxFrames > 0 && len(frames) > maxFrames {
+		trace = append(frames[:maxFrames:maxFrames],
+			fmt.Sprintf("...%d additional frames omitted", len(frames)-maxFrames))
+	}
+
+	return []zap.Field{
+		zap.Any("error", recovered),
+		zap.String("panicType", fmt.Sprintf("%T", recovered)),
+		zap.String("goroutine", goroutine),
+		zap.String("traceback", strings.Join(trace, "\n")),
+	}
+}
+
+// parseStack splits the output of debug.Stack() into the goroutine ID
+// and its frames, each of which is the function followed by its location
+func parseStack(stack string) (string, []string) {
+	lines := strings.Split(strings.TrimRight(stack, "\n"), "\n")
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	// the header looks like "goroutine 42 [running]:"
+	var goroutine string
+	if fields := strings.Fields(lines[0]); len(fields) >= 2 && fields[0] == "goroutine" {
+		goroutine = fields[1]
+		lines = lines[1:]
+	}
+
+	frames := make([]string, 0, len(lines)/2+1)
+	for i := 0; i < len(lines); i += 2 {
+		frame := lines[i]
+		if i+1 < len(lines) {
+			frame += "\n" + lines[i+1]
+		}
+		frames = append(frames, frame)
+	}
+
+	return goroutine, frames
+}
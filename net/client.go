@@ -22,17 +22,54 @@
 package net
 
 import (
+	"context"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"time"
 
 	"golang.org/x/net/http2"
+
+	"github.com/mchudgins/go/net/server/baggage"
+	"github.com/mchudgins/go/net/server/budget"
+	"github.com/mchudgins/go/net/server/correlationID"
 )
 
+// DefaultIdleConnTimeout is how long the transports keep an idle connection
+// open.  Without a limit, connections to a backend which has been drained,
+// but not closed, remain open indefinitely and file descriptors accumulate;
+// with too short a limit, bursty traffic must repeatedly reconnect.
+const DefaultIdleConnTimeout = 90 * time.Second
+
+// TransportOption customizes the http.Transport of the clients & round trippers
+type TransportOption func(*http.Transport)
+
+// WithIdleConnTimeout closes connections which have been idle for d;
+// zero keeps them open until the server closes them
+func WithIdleConnTimeout(d time.Duration) TransportOption {
+	return func(t *http.Transport) { t.IdleConnTimeout = d }
+}
+
+// CloseIdleConnections closes the idle connections of rt, if it supports
+// it, e.g., from a server.ShutdownHook or when a downstream service begins
+// draining.  Connections in use are unaffected.  The clients returned by
+// NewClient & NewRemoteClient have an equivalent CloseIdleConnections method.
+func CloseIdleConnections(rt http.RoundTripper) {
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func applyTransportOptions(t *http.Transport, options []TransportOption) {
+	for _, option := range options {
+		option(t)
+	}
+}
+
 // NewClient provides an http.Client suitable for use within the datacenter
-func NewClient() *http.Client {
-	transport := NewRoundTripper()
+func NewClient(options ...TransportOption) *http.Client {
+	transport := NewRoundTripper(options...)
 
 	client := http.Client{
 		// everything is o' so close!
@@ -49,14 +86,76 @@ func NewClient() *http.Client {
 	return &client
 }
 
-// NewRoundTripper provides an http.RoundTripper for use within the datacenter
-func NewRoundTripper() http.RoundTripper {
+// budgetTransport propagates the correlation ID, baggage and remaining time
+// budget of the request's context to the downstream service
+type budgetTransport struct {
+	transport http.RoundTripper
+	fraction  float64
+}
+
+// NewBudgetRoundTripper wraps rt so that outgoing requests carry the
+// correlation ID, baggage and a deadline of the given fraction of the time
+// remaining in the request's context (see budget.DownstreamContext).  The
+// deadline is sent to the downstream service in the X-Request-Timeout
+// header.  The datacenter round trippers propagate the entire budget.
+func NewBudgetRoundTripper(rt http.RoundTripper, fraction float64) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &budgetTransport{transport: rt, fraction: fraction}
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := budget.DownstreamContext(req.Context(), t.fraction)
+
+	// RoundTrip must not modify the caller's request
+	req = req.Clone(ctx)
+
+	if corrID := correlationID.FromContext(ctx); len(corrID) > 0 && len(req.Header.Get(correlationID.CORRID)) == 0 {
+		req.Header.Set(correlationID.CORRID, corrID)
+	}
+	baggage.ToHeader(ctx, req.Header)
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(budget.RequestTimeoutHeader, time.Until(deadline).String())
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the context must remain alive until the caller has consumed the body
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *budgetTransport) CloseIdleConnections() {
+	CloseIdleConnections(t.transport)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// NewRoundTripper provides an http.RoundTripper for use within the datacenter.
+// Requests carry the correlation ID, baggage & time budget of their context.
+func NewRoundTripper(options ...TransportOption) http.RoundTripper {
 	transport := &http.Transport{
 		Proxy:                  func(*http.Request) (*url.URL, error) { return nil, nil }, // never explicitly proxy, use transparent proxy
 		MaxConnsPerHost:        250,
 		MaxIdleConns:           100,
 		MaxIdleConnsPerHost:    100,
-		IdleConnTimeout:        0, // never timeout, let the server close
+		IdleConnTimeout:        DefaultIdleConnTimeout,
 		ResponseHeaderTimeout:  1 * time.Second,
 		ExpectContinueTimeout:  100 * time.Millisecond,
 		MaxResponseHeaderBytes: 8 * 1024,
@@ -68,21 +167,23 @@ func NewRoundTripper() http.RoundTripper {
 			DualStack: true,
 		}).DialContext,
 	}
+	applyTransportOptions(transport, options)
 	if err := http2.ConfigureTransport(transport); err != nil {
 		panic(err)
 	}
 
-	return transport
+	return NewBudgetRoundTripper(transport, 1)
 }
 
-// NewInsecureRoundTripper provides an insecure http.RoundTripper for use within the datacenter
-func NewInsecureRoundTripper() http.RoundTripper {
+// NewInsecureRoundTripper provides an insecure http.RoundTripper for use within the datacenter.
+// Like NewRoundTripper, it propagates the context of each request.
+func NewInsecureRoundTripper(options ...TransportOption) http.RoundTripper {
 	transport := &http.Transport{
 		Proxy:                  func(*http.Request) (*url.URL, error) { return nil, nil }, // never explicitly proxy, use transparent proxy
 		MaxConnsPerHost:        250,
 		MaxIdleConns:           100,
 		MaxIdleConnsPerHost:    100,
-		IdleConnTimeout:        0, // never timeout, let the server close
+		IdleConnTimeout:        DefaultIdleConnTimeout,
 		ResponseHeaderTimeout:  5 * time.Second,
 		ExpectContinueTimeout:  100 * time.Millisecond,
 		MaxResponseHeaderBytes: 8 * 1024,
@@ -94,19 +195,20 @@ func NewInsecureRoundTripper() http.RoundTripper {
 			DualStack: true,
 		}).DialContext,
 	}
+	applyTransportOptions(transport, options)
 	if err := http2.ConfigureTransport(transport); err != nil {
 		panic(err)
 	}
 
 	transport.TLSClientConfig.InsecureSkipVerify = true
 
-	return transport
+	return NewBudgetRoundTripper(transport, 1)
 }
 
 // NewRemoteClient provides an http.Client suitable for use
 // when contacting an endpoint outside the datacenter
-func NewRemoteClient() *http.Client {
-	transport := NewRemoteRoundTripper()
+func NewRemoteClient(options ...TransportOption) *http.Client {
+	transport := NewRemoteRoundTripper(options...)
 
 	client := http.Client{
 		// everything is o' so far away!
@@ -124,15 +226,16 @@ func NewRemoteClient() *http.Client {
 }
 
 // NewRemoteRoundTripper provides an http.RoundTripper suitable for use
-// when contacting an endpoint outside the datacenter
+// when contacting an endpoint outside the datacenter.  The correlation ID
+// & baggage of the request's context are not propagated.
 
-func NewRemoteRoundTripper() http.RoundTripper {
+func NewRemoteRoundTripper(options ...TransportOption) http.RoundTripper {
 	transport := &http.Transport{
 		Proxy:                  func(*http.Request) (*url.URL, error) { return nil, nil }, // never explicitly proxy, use transparent proxy
 		MaxConnsPerHost:        250,
 		MaxIdleConns:           100,
 		MaxIdleConnsPerHost:    100,
-		IdleConnTimeout:        0, // never timeout, let the server close
+		IdleConnTimeout:        DefaultIdleConnTimeout,
 		ResponseHeaderTimeout:  10 * time.Second,
 		ExpectContinueTimeout:  1 * time.Second,
 		MaxResponseHeaderBytes: 8 * 1024,
@@ -144,6 +247,7 @@ func NewRemoteRoundTripper() http.RoundTripper {
 			DualStack: true,
 		}).DialContext,
 	}
+	applyTransportOptions(transport, options)
 	if err := http2.ConfigureTransport(transport); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,102 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+
+package net
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mchudgins/go/net/server/baggage"
+	"github.com/mchudgins/go/net/server/budget"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+func TestRoundTripperPropagatesContext(t *testing.T) {
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = correlationID.NewContext(ctx, "3f2504e0-4f89-41d3-9a0c-0305e82c3301")
+	ctx, err := baggage.Set(ctx, "Tenant-ID", "acme")
+	assert.NoError(t, err)
+
+	get := func(rt http.RoundTripper) *http.Request {
+		received = nil
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, "ok", string(body))
+			assert.NoError(t, resp.Body.Close())
+		}
+		return req
+	}
+
+	rt := NewRoundTripper()
+	req := get(rt)
+	assert.Empty(t, req.Header, "the caller's request must not be modified")
+	assert.Equal(t, "3f2504e0-4f89-41d3-9a0c-0305e82c3301", received.Get(correlationID.CORRID))
+	assert.Equal(t, "acme", received.Get("Baggage-Tenant-Id"))
+	if timeout, err := time.ParseDuration(received.Get(budget.RequestTimeoutHeader)); assert.NoError(t, err) {
+		assert.True(t, timeout > 0 && timeout <= 5*time.Second, timeout)
+	}
+	CloseIdleConnections(rt)
+
+	// the request's context is not sent outside the datacenter
+	get(NewRemoteRoundTripper())
+	assert.Empty(t, received.Get(correlationID.CORRID))
+	assert.Empty(t, received.Get("Baggage-Tenant-Id"))
+	assert.Empty(t, received.Get(budget.RequestTimeoutHeader))
+}
+
+func TestBudgetRoundTripperFraction(t *testing.T) {
+	var deadline time.Time
+	rt := NewBudgetRoundTripper(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		deadline, _ = r.Context().Deadline()
+		return httptest.NewRecorder().Result(), nil
+	}), 0.5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://downstream/", nil)
+	resp, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), deadline, time.Second)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
@@ -0,0 +1,130 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+
+package net
+
+import (
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	listenerConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "listener_connections",
+			Help: "Number of connections currently accepted by a limited listener.",
+		},
+		[]string{"listener"},
+	)
+	listenerSaturated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "listener_saturated_total",
+			Help: "Number of times a limited listener reached capacity, leaving new connections waiting to be accepted.",
+		},
+		[]string{"listener"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(listenerConnections)
+	prometheus.MustRegister(listenerSaturated)
+}
+
+// LimitListener returns a Listener which permits at most max
+// simultaneous connections.  While the listener is at capacity, it stops
+// accepting: new connections wait in the accept queue until one of the
+// accepted connections closes, and are refused by the OS once the queue
+// is full.
+func LimitListener(l net.Listener, max int) net.Listener {
+	return &limitListener{
+		Listener: l,
+		sem:      make(chan struct{}, max),
+		done:     make(chan struct{}),
+		name:     l.Addr().String(),
+	}
+}
+
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	name      string
+}
+
+// acquire waits for a free connection slot, returning false if the
+// listener is closed first
+func (l *limitListener) acquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	listenerSaturated.WithLabelValues(l.name).Inc()
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+
+	listenerConnections.WithLabelValues(l.name).Inc()
+	return &limitListenerConn{Conn: c, release: l.release}, nil
+}
+
+// Close closes the listener, including an Accept waiting for a free slot
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+func (l *limitListener) release() {
+	<-l.sem
+	listenerConnections.WithLabelValues(l.name).Dec()
+}
+
+type limitListenerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,119 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	limited := LimitListener(lis, 2)
+	defer limited.Close()
+
+	accepted := make(chan net.Conn, 3)
+	go func() {
+		for {
+			c, err := limited.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	accept := func(wait time.Duration) net.Conn {
+		select {
+		case c := <-accepted:
+			return c
+		case <-time.After(wait):
+			return nil
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("tcp", lis.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer c.Close()
+	}
+
+	first, second := accept(time.Second), accept(time.Second)
+	if !assert.NotNil(t, first) || !assert.NotNil(t, second) {
+		return
+	}
+
+	// the third connection waits while the listener is at capacity...
+	assert.Nil(t, accept(200*time.Millisecond), "accepted beyond the limit")
+
+	// ...until one of the others closes
+	assert.NoError(t, first.Close())
+	third := accept(time.Second)
+	if assert.NotNil(t, third, "not accepted once a connection closed") {
+		third.Close()
+	}
+	second.Close()
+}
+
+func TestLimitListenerCloseUnblocksAccept(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	limited := LimitListener(lis, 1)
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	held, err := limited.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer held.Close()
+
+	// at capacity, Accept waits for a free slot, or for the listener to close
+	errc := make(chan error, 1)
+	go func() {
+		_, err := limited.Accept()
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, limited.Close())
+
+	select {
+	case err := <-errc:
+		assert.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Accept still waiting after Close")
+	}
+}
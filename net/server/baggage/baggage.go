@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+// Package baggage carries arbitrary key/value pairs, e.g., a tenant ID or
+// feature flags, with a request: through the request context, into the
+// access log and on to downstream services as "Baggage-<key>" HTTP headers
+// or "baggage-<key>" gRPC metadata.  The number & size of the entries are
+// bounded to prevent header bloat.  Since any client can send baggage, the
+// access loggers accept it only from the callers permitted by
+// handler.WithInboundBaggage.
+package baggage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/mchudgins/go/net/server/requestContext"
+)
+
+const (
+	// HeaderPrefix precedes each key in the HTTP headers & gRPC metadata
+	HeaderPrefix = "Baggage-"
+
+	// MaxEntries is the most entries a request may carry
+	MaxEntries = 16
+	// MaxKeyLength is the longest key permitted
+	MaxKeyLength = 64
+	// MaxValueLength is the longest value permitted
+	MaxValueLength = 256
+)
+
+var (
+	// ErrTooManyEntries is returned when an entry would exceed MaxEntries
+	ErrTooManyEntries = errors.New("too many baggage entries")
+	// ErrInvalidEntry is returned for an empty, overlong or malformed key,
+	// or an overlong or malformed value
+	ErrInvalidEntry = errors.New("invalid baggage entry")
+)
+
+// metadataPrefix is HeaderPrefix as a gRPC metadata key, which is lowercase
+var metadataPrefix = strings.ToLower(HeaderPrefix)
+
+// Get returns the value of key carried by ctx
+func Get(ctx context.Context, key string) (string, bool) {
+	value, ok := requestContext.FromContext(ctx).Baggage[strings.ToLower(key)]
+	return value, ok
+}
+
+// All returns a copy of the baggage carried by ctx, or nil if there is none
+func All(ctx context.Context) map[string]string {
+	baggage := requestContext.FromContext(ctx).Baggage
+	if len(baggage) == 0 {
+		return nil
+	}
+
+	all := make(map[string]string, len(baggage))
+	for k, v := range baggage {
+		all[k] = v
+	}
+
+	return all
+}
+
+// Set returns a Context carrying key=value in addition to the baggage of
+// ctx.  Keys are case-insensitive and may contain letters, digits, "-",
+// "_" and "."; values may contain any printable ASCII.
+func Set(ctx context.Context, key, value string) (context.Context, error) {
+	key = strings.ToLower(key)
+	if !validKey(key) || !validValue(value) {
+		return ctx, ErrInvalidEntry
+	}
+
+	baggage := requestContext.FromContext(ctx).Baggage
+	if _, ok := baggage[key]; !ok && len(baggage) >= MaxEntries {
+		return ctx, ErrTooManyEntries
+	}
+
+	return requestContext.Update(ctx, func(rc *requestContext.RequestContext) {
+		updated := make(map[string]string, len(rc.Baggage)+1)
+		for k, v := range rc.Baggage {
+			updated[k] = v
+		}
+		updated[key] = value
+		rc.Baggage = updated
+	}), nil
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func validValue(value string) bool {
+	if len(value) > MaxValueLength {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if value[i] < ' ' || value[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FromHeader returns a Context carrying the baggage of ctx plus the
+// entries of the Baggage-* headers of h.  Entries which are invalid or
+// beyond MaxEntries are dropped.
+func FromHeader(ctx context.Context, h http.Header) context.Context {
+	for name, values := range h {
+		if len(values) == 0 || len(name) <= len(HeaderPrefix) || !strings.EqualFold(name[:len(HeaderPrefix)], HeaderPrefix) {
+			continue
+		}
+
+		ctx, _ = Set(ctx, name[len(HeaderPrefix):], values[0])
+	}
+
+	return ctx
+}
+
+// ToHeader adds the baggage of ctx to h as Baggage-* headers
+func ToHeader(ctx context.Context, h http.Header) {
+	for k, v := range requestContext.FromContext(ctx).Baggage {
+		h.Set(HeaderPrefix+k, v)
+	}
+}
+
+// FromMetadata returns a Context carrying the baggage of ctx plus the
+// entries of the baggage-* keys of md.  Entries which are invalid or
+// beyond MaxEntries are dropped.
+func FromMetadata(ctx context.Context, md metadata.MD) context.Context {
+	for name, values := range md {
+		if len(values) == 0 || len(name) <= len(metadataPrefix) || !strings.HasPrefix(name, metadataPrefix) {
+			continue
+		}
+
+		ctx, _ = Set(ctx, name[len(metadataPrefix):], values[0])
+	}
+
+	return ctx
+}
+
+// AppendToOutgoingContext returns a Context whose outgoing gRPC metadata
+// carries the baggage of ctx
+func AppendToOutgoingContext(ctx context.Context) context.Context {
+	baggage := requestContext.FromContext(ctx).Baggage
+	if len(baggage) == 0 {
+		return ctx
+	}
+
+	kv := make([]string, 0, 2*len(baggage))
+	for k, v := range baggage {
+		kv = append(kv, metadataPrefix+k, v)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package baggage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetBounds(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < MaxEntries; i++ {
+		var err error
+		ctx, err = Set(ctx, "key"+strconv.Itoa(i), "value")
+		assert.NoError(t, err)
+	}
+
+	_, err := Set(ctx, "one-too-many", "value")
+	assert.Equal(t, ErrTooManyEntries, err)
+
+	// replacing an existing entry doesn't add one
+	updated, err := Set(ctx, "KEY0", "replaced")
+	assert.NoError(t, err)
+	v, _ := Get(updated, "key0")
+	assert.Equal(t, "replaced", v)
+	v, _ = Get(ctx, "key0")
+	assert.Equal(t, "value", v, "the parent context must be unchanged")
+
+	for _, kv := range [][2]string{
+		{"", "value"},
+		{"has space", "value"},
+		{strings.Repeat("k", MaxKeyLength+1), "value"},
+		{"key", strings.Repeat("v", MaxValueLength+1)},
+		{"key", "line\nbreak"},
+	} {
+		_, err := Set(context.Background(), kv[0], kv[1])
+		assert.Equal(t, ErrInvalidEntry, err, kv[0])
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2024 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package budget carries a request's remaining time budget to the
+// services it calls.  It has no server dependencies, so that clients,
+// e.g., the net package's round trippers, may use it, too.
+package budget
+
+import (
+	"context"
+	"time"
+)
+
+// RequestTimeoutHeader carries the caller's remaining time budget to downstream HTTP services
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// DownstreamContext derives a child context whose deadline is the given
+// fraction (0 < fraction <= 1) of the time remaining in ctx.  If ctx
+// has no deadline, the child simply inherits ctx's cancellation.
+func DownstreamContext(ctx context.Context, fraction float64) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	if fraction <= 0 || fraction > 1 {
+		fraction = 1
+	}
+
+	remaining := time.Until(deadline)
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*fraction))
+}
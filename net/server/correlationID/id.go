@@ -5,23 +5,41 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
-)
 
-type key struct{}
+	"github.com/mchudgins/go/net/server/requestContext"
+)
 
 const (
 	CORRID       = "X-Request-Id" // HTTP header name
 	RequestIDKey = "requestID"    // logging field name
 )
 
-var (
-	// NotFound returned when the USERID header is not in the request
-	//IDNotFound    error = fmt.Errorf("%s not found", CORRID)
-	correlationID = key{} // context field name
-)
+// MaxLength is the longest correlation ID accepted from a client
+const MaxLength = 128
 
 func NewID() string { return uuid.New().String() }
 
+// Valid reports whether id is safe to log & propagate: no longer than
+// MaxLength and composed only of letters, digits and "-", "_", ".", ":".
+// This admits UUIDs and W3C trace IDs, but not whitespace, quotes or
+// control characters.
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > MaxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 // FromRequest retrieves/creates the request ID
 func FromRequest(req *http.Request) (string, bool) {
 	fExisted := false
@@ -36,17 +54,12 @@ func FromRequest(req *http.Request) (string, bool) {
 
 // FromContext retrieves the request ID from a context
 func FromContext(ctx context.Context) string {
-	val, ok := ctx.Value(correlationID).(string)
-	if ok {
-		return val
-	}
-	return ""
+	return requestContext.FromContext(ctx).CorrelationID
 }
 
 // NewContext returns a new Context that carries the provided correlation ID
 func NewContext(ctx context.Context, id string) context.Context {
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	return context.WithValue(ctx, correlationID, id)
+	return requestContext.Update(ctx, func(rc *requestContext.RequestContext) {
+		rc.CorrelationID = id
+	})
 }
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	gsh "github.com/mchudgins/go/net/server/handler"
+)
+
+// debugConfigPath is the metrics server path of the effective configuration
+const debugConfigPath = "/debug/config"
+
+// redacted replaces the value of a field tagged `redact:"true"`
+const redacted = "[REDACTED]"
+
+// effectiveSettings returns the Settings equivalent to cfg, once the
+// options have been applied.  The access log options, e.g., ServerTiming
+// & RedactedMetadata, are opaque and so are not reported.
+func (cfg *Config) effectiveSettings() Settings {
+	timeouts := cfg.httpTimeouts
+	if cfg.httpServer != nil { // e.g., WithPublicEndpoint
+		if timeouts.read == 0 {
+			timeouts.read = cfg.httpServer.ReadTimeout
+		}
+		if timeouts.write == 0 {
+			timeouts.write = cfg.httpServer.WriteTimeout
+		}
+		if timeouts.idle == 0 {
+			timeouts.idle = cfg.httpServer.IdleTimeout
+		}
+	}
+
+	return Settings{
+		HTTPListenPort:    cfg.HTTPListenPort,
+		RPCListenPort:     cfg.RPCListenPort,
+		MetricsListenPort: cfg.MetricsListenPort,
+
+		CertFilename:        cfg.CertFilename,
+		KeyFilename:         cfg.KeyFilename,
+		MetricsTLS:          cfg.metricsTLS,
+		MetricsCertFilename: cfg.metricsCertFilename,
+		MetricsKeyFilename:  cfg.metricsKeyFilename,
+		SNICertificates:     cfg.sniCertificates,
+
+		HTTPReadTimeout:     timeouts.read,
+		HTTPWriteTimeout:    timeouts.write,
+		HTTPIdleTimeout:     timeouts.idle,
+		RPCMaxConnectionAge: cfg.rpcMaxConnectionAge,
+		MaxConnections:      cfg.maxConnections,
+		MaxHeaderBytes:      cfg.maxHeaderBytes,
+
+		CanonicalHost:        cfg.Hostname,
+		Gzip:                 cfg.Compress,
+		HystrixStream:        cfg.hystrixStream,
+		HystrixStreamOrigins: cfg.hystrixStreamOrigins,
+		RuntimeMetrics:       cfg.runtimeMetrics,
+		Minimal:              cfg.minimal,
+		Tracer:               cfg.UseTracer,
+		ServiceName:          cfg.serviceName,
+		Environment:          cfg.environment,
+	}
+}
+
+// effectiveConfig returns the effective, redacted configuration served
+// at /debug/config on the metrics server
+func (cfg *Config) effectiveConfig() map[string]interface{} {
+	config := redact(reflect.ValueOf(cfg.effectiveSettings())).(map[string]interface{})
+
+	config["tls"] = !cfg.Insecure
+	config["logLevel"] = cfg.logger.Level().String()
+	if !cfg.Insecure {
+		config["httpClientAuth"] = cfg.clientAuth.String()
+		config["rpcClientAuth"] = cfg.rpcClientAuth.String()
+	}
+	if cfg.metricsTLS {
+		config["metricsClientAuth"] = cfg.metricsClientAuth.String()
+	}
+
+	return config
+}
+
+// redact converts v to maps & slices for encoding, keyed by the fields'
+// json names, replacing the values of the fields tagged `redact:"true"`
+// and omitting the empty values of the fields tagged omitempty
+func redact(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if len(name) == 0 {
+				name = field.Name
+			}
+
+			value := v.Field(i)
+			if value.IsZero() && strings.Contains(opts, "omitempty") {
+				continue
+			}
+
+			if field.Tag.Get("redact") == "true" {
+				m[name] = redacted
+			} else {
+				m[name] = redact(value)
+			}
+		}
+		return m
+
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = redact(iter.Value())
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = redact(v.Index(i))
+		}
+		return s
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redact(v.Elem())
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	return v.Interface()
+}
+
+// debugConfigHandler serves config as JSON
+func debugConfigHandler(config map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = gsh.EncodeJSON(w, r, config, true)
+	})
+}
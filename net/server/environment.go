@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// environmentLabel is the name of the label added by WithEnvironment
+const environmentLabel = "env"
+
+// labelingGatherer adds a constant label to every metric it gathers,
+// unless the metric already has a label of that name.  The server's
+// metrics (and those of the libraries it uses) are registered with the
+// default registry when their packages are initialized, so the label is
+// added as they are served rather than when they are registered.
+type labelingGatherer struct {
+	prometheus.Gatherer
+	label *dto.LabelPair
+}
+
+func newLabelingGatherer(g prometheus.Gatherer, name, value string) prometheus.Gatherer {
+	return &labelingGatherer{
+		Gatherer: g,
+		label:    &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)},
+	}
+}
+
+func (g *labelingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			if !hasLabel(metric, g.label.GetName()) {
+				metric.Label = append(metric.Label, g.label)
+			}
+		}
+	}
+
+	return families, err
+}
+
+func hasLabel(metric *dto.Metric, name string) bool {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			return true
+		}
+	}
+
+	return false
+}
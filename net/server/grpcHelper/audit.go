@@ -0,0 +1,164 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchudgins/go/log"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+// AuditRecord describes a single invocation of a mutating RPC
+type AuditRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Method     string    `json:"method"`
+	RemoteUser string    `json:"remoteUser,omitempty"`
+	RemoteIP   string    `json:"remoteIP,omitempty"`
+	RequestID  string    `json:"requestID,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditSink persists audit records
+type AuditSink interface {
+	Record(ctx context.Context, rec AuditRecord) error
+}
+
+// Audit returns a unary interceptor which records an AuditRecord to the sink
+// for each method for which isMutation returns true.  If sink is nil,
+// records are logged with the security marker via the context's logger.
+func Audit(isMutation func(fullMethod string) bool, sink AuditSink) grpc.UnaryServerInterceptor {
+	if sink == nil {
+		sink = NewZapAuditSink(nil)
+	}
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if !isMutation(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		rec := AuditRecord{
+			Timestamp: time.Now(),
+			Method:    info.FullMethod,
+			RequestID: correlationID.FromContext(ctx),
+		}
+		rec.RemoteUser, rec.RemoteIP, _ = CallerInfo(ctx)
+
+		resp, err := handler(ctx, req)
+
+		rec.Status = status.Code(err).String()
+		if err != nil {
+			rec.Error = err.Error()
+		}
+
+		if serr := sink.Record(ctx, rec); serr != nil {
+			log.FromContext(ctx).Error("unable to record audit event",
+				log.SecurityMarker,
+				zap.String("method", info.FullMethod),
+				zap.Error(serr))
+		}
+
+		return resp, err
+	}
+}
+
+// ZapAuditSink logs audit records with the security marker
+type ZapAuditSink struct {
+	logger *zap.Logger
+}
+
+// NewZapAuditSink returns a sink which logs to logger or,
+// if logger is nil, to the logger found in the request's context
+func NewZapAuditSink(logger *zap.Logger) *ZapAuditSink {
+	return &ZapAuditSink{logger: logger}
+}
+
+func (s *ZapAuditSink) Record(ctx context.Context, rec AuditRecord) error {
+	logger := s.logger
+	if logger == nil {
+		logger = log.FromContext(ctx)
+	}
+
+	logger.Info("audit",
+		log.SecurityMarker,
+		zap.Time("timestamp", rec.Timestamp),
+		zap.String("method", rec.Method),
+		zap.String("remoteUser", rec.RemoteUser),
+		zap.String("remoteIP", rec.RemoteIP),
+		zap.String(correlationID.RequestIDKey, rec.RequestID),
+		zap.String("status", rec.Status),
+		zap.String("error", rec.Error))
+
+	return nil
+}
+
+// FileAuditSink appends audit records, one JSON object per line,
+// to a file.  Each record is synced to disk before Record returns.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileAuditSink opens (or creates) the file at path for appending
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *FileAuditSink) Record(ctx context.Context, rec AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enc.Encode(rec); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// Close closes the underlying file
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	eccolog "github.com/mchudgins/go/log"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+const auditRequestID = "3f2504e0-4f89-41d3-9a0c-0305e82c3301"
+
+// auditContext returns the context of a call from the verified client "alice"
+func auditContext() context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 50000},
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+
+	return correlationID.NewContext(ctx, auditRequestID)
+}
+
+func isMutation(method string) bool {
+	return !strings.Contains(method, "/Get")
+}
+
+func callAudited(t *testing.T, interceptor grpc.UnaryServerInterceptor, ctx context.Context, method string, err error) {
+	_, got := interceptor(ctx, "request", &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return "response", err })
+	assert.Equal(t, err, got)
+}
+
+func TestAuditZapSink(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+	interceptor := Audit(isMutation, NewZapAuditSink(logger))
+
+	callAudited(t, interceptor, auditContext(), "/orders.Orders/Get", nil)
+	assert.Empty(t, buf.String(), "only mutations are audited")
+
+	callAudited(t, interceptor, auditContext(), "/orders.Orders/Delete", status.Error(codes.PermissionDenied, "not yours"))
+
+	var entry map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry)) {
+		return
+	}
+	assert.Equal(t, "audit", entry["msg"])
+	assert.Equal(t, []interface{}{"security"}, entry["markers"])
+	assert.Equal(t, "/orders.Orders/Delete", entry["method"])
+	assert.Equal(t, "alice", entry["remoteUser"])
+	assert.Equal(t, "10.1.2.3:50000", entry["remoteIP"])
+	assert.Equal(t, auditRequestID, entry[correlationID.RequestIDKey])
+	assert.Equal(t, codes.PermissionDenied.String(), entry["status"])
+	assert.Contains(t, entry["error"], "not yours")
+	assert.NotEmpty(t, entry["timestamp"])
+}
+
+func TestAuditFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	interceptor := Audit(isMutation, sink)
+
+	start := time.Now()
+	callAudited(t, interceptor, auditContext(), "/orders.Orders/Create", nil)
+	callAudited(t, interceptor, context.Background(), "/orders.Orders/Delete", status.Error(codes.NotFound, "no such order"))
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var rec AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	if !assert.Len(t, records, 2) {
+		return
+	}
+
+	assert.Equal(t, "/orders.Orders/Create", records[0].Method)
+	assert.Equal(t, "alice", records[0].RemoteUser)
+	assert.Equal(t, auditRequestID, records[0].RequestID)
+	assert.Equal(t, codes.OK.String(), records[0].Status)
+	assert.Empty(t, records[0].Error)
+	assert.WithinDuration(t, start, records[0].Timestamp, time.Minute)
+
+	// an unauthenticated caller is still audited
+	assert.Empty(t, records[1].RemoteUser)
+	assert.Equal(t, codes.NotFound.String(), records[1].Status)
+	assert.Contains(t, records[1].Error, "no such order")
+}
+
+type failingSink struct{}
+
+func (failingSink) Record(context.Context, AuditRecord) error { return errors.New("disk full") }
+
+func TestAuditSinkFailureIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+	ctx := eccolog.NewContext(auditContext(), logger)
+
+	// the call itself succeeds
+	callAudited(t, Audit(isMutation, failingSink{}), ctx, "/orders.Orders/Create", nil)
+
+	assert.Contains(t, buf.String(), "unable to record audit event")
+	assert.Contains(t, buf.String(), "disk full")
+	assert.Contains(t, buf.String(), `"markers":["security"]`)
+}
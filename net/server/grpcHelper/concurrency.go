@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "grpc_server_concurrency_in_flight",
+			Help: "Number of requests in progress for methods with a concurrency limit.",
+		},
+		[]string{"method"},
+	)
+
+	rpcConcurrencyRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_concurrency_rejected_total",
+			Help: "Number of requests rejected because their method's concurrency limit was reached.",
+		},
+		[]string{"method"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rpcInFlight)
+	prometheus.MustRegister(rpcConcurrencyRejected)
+}
+
+// ConcurrencyLimit returns a unary interceptor which limits the number of
+// requests in progress for each method in perMethod, keyed by full method
+// name, e.g., "/pkg.Service/Method".  Requests beyond a method's limit fail
+// immediately with codes.ResourceExhausted, rather than queueing; methods
+// not in perMethod are unlimited.
+func ConcurrencyLimit(perMethod map[string]int) grpc.UnaryServerInterceptor {
+	// a buffered channel per method serves as its semaphore
+	semaphores := make(map[string]chan struct{}, len(perMethod))
+	for method, limit := range perMethod {
+		if limit > 0 {
+			semaphores[method] = make(chan struct{}, limit)
+		}
+	}
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		sem, ok := semaphores[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			rpcConcurrencyRejected.WithLabelValues(info.FullMethod).Inc()
+			return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent requests for %s", info.FullMethod)
+		}
+
+		inFlight := rpcInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer func() {
+			inFlight.Dec()
+			<-sem
+		}()
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func concurrencyMetric(t *testing.T, name, method string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() != method {
+				continue
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 2
+	const method = "/test.Service/TestConcurrencyLimit"
+	interceptor := ConcurrencyLimit(map[string]int{method: limit})
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	held := func(ctx context.Context, req interface{}) (interface{}, error) {
+		entered <- struct{}{}
+		<-release
+		return "ok", nil
+	}
+	immediate := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	rejected := concurrencyMetric(t, "grpc_server_concurrency_rejected_total", method)
+
+	// fill every slot
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := interceptor(context.Background(), nil, info, held)
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", resp)
+		}()
+		<-entered
+	}
+	assert.Equal(t, float64(limit), concurrencyMetric(t, "grpc_server_concurrency_in_flight", method))
+
+	// one more is rejected, rather than queued
+	resp, err := interceptor(context.Background(), nil, info, immediate)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, rejected+1, concurrencyMetric(t, "grpc_server_concurrency_rejected_total", method))
+
+	// other methods are unlimited
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Other"}, immediate)
+	assert.NoError(t, err)
+
+	// a completed request releases its slot
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		_, err := interceptor(context.Background(), nil, info, immediate)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(limit-1), concurrencyMetric(t, "grpc_server_concurrency_in_flight", method))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, float64(0), concurrencyMetric(t, "grpc_server_concurrency_in_flight", method))
+}
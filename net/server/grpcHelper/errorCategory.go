@@ -0,0 +1,85 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var rpcErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_server_errors_total",
+		Help: "Number of unary gRPC requests which failed, by method, status code and error category.",
+	},
+	[]string{"method", "code", "category"},
+)
+
+func init() {
+	prometheus.MustRegister(rpcErrors)
+}
+
+// ErrorCategory maps a gRPC status code to a coarse category of error:
+// "client" for requests the caller should not retry unchanged,
+// "unavailable" for transient failures, "timeout" for deadlines and
+// cancellations, and "server" for failures of the service itself.
+// codes.OK maps to "".
+func ErrorCategory(code codes.Code) string {
+	switch code {
+	case codes.OK:
+		return ""
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return "client"
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return "unavailable"
+	case codes.DeadlineExceeded, codes.Canceled:
+		return "timeout"
+	default: // Unknown, Internal, Unimplemented, DataLoss
+		return "server"
+	}
+}
+
+// ErrorCounter returns a unary interceptor which counts failed requests
+// by method, status code and ErrorCategory.  The free-form status
+// message is not recorded, to keep the number of series bounded.
+func ErrorCounter() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		resp, err := handler(ctx, req)
+
+		if code := status.Code(err); code != codes.OK {
+			rpcErrors.WithLabelValues(info.FullMethod, code.String(), ErrorCategory(code)).Inc()
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"errors"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HystrixUnaryClientInterceptor returns a client interceptor which makes
+// calls via the hystrix command commandName, configured by config.  Calls
+// failing with a code indicating an unhealthy server (see
+// circuitBreakerFailure) count towards opening the circuit; other errors
+// are returned without counting.  While the circuit is open, or when the
+// command times out or is at its concurrency limit, calls fail at once
+// with codes.Unavailable.
+func HystrixUnaryClientInterceptor(commandName string, config hystrix.CommandConfig, logger *zap.Logger) grpc.UnaryClientInterceptor {
+	hystrix.ConfigureCommand(commandName, config)
+	logger = logger.With(zap.String("hystrixCommand", commandName))
+
+	return func(ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		// a call abandoned by a hystrix timeout should not run on
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// errors which don't indicate an unhealthy server bypass the
+		// circuit's accounting; buffered, since run may outlive the call
+		callErr := make(chan error, 1)
+
+		err := hystrix.DoC(ctx, commandName, func(ctx context.Context) error {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err != nil && !circuitBreakerFailure(status.Code(err)) {
+				callErr <- err
+				return nil
+			}
+			return err
+		}, nil)
+
+		var circuitErr hystrix.CircuitError
+		if errors.As(err, &circuitErr) {
+			logger.Debug("call not completed",
+				zap.String("method", method),
+				zap.Error(err))
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case err = <-callErr:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+// circuitBreakerFailure reports whether code indicates a server which is
+// unhealthy, rather than a request which failed on its merits
+func circuitBreakerFailure(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHystrixUnaryClientInterceptorOpensCircuit(t *testing.T) {
+	const name = "TestHystrixUnaryClientInterceptorOpensCircuit"
+	interceptor := HystrixUnaryClientInterceptor(name, hystrix.CommandConfig{
+		Timeout:                1000,
+		RequestVolumeThreshold: 3,
+		ErrorPercentThreshold:  50,
+		SleepWindow:            60000,
+	}, zap.NewNop())
+
+	calls := 0
+	invoke := func(code codes.Code) error {
+		return interceptor(context.Background(), "/test.Service/Method", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				return status.Error(code, code.String())
+			})
+	}
+
+	// errors on the request's merits don't count towards opening the circuit
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, codes.NotFound, status.Code(invoke(codes.NotFound)))
+	}
+	time.Sleep(50 * time.Millisecond)
+	circuit, _, _ := hystrix.GetCircuit(name)
+	assert.False(t, circuit.IsOpen())
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, codes.Unavailable, status.Code(invoke(codes.Unavailable)))
+	}
+	assert.Eventually(t, circuit.IsOpen, time.Second, 10*time.Millisecond)
+
+	calls = 0
+	err := invoke(codes.OK)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), "circuit open")
+	assert.Zero(t, calls, "an open circuit should not call the server")
+}
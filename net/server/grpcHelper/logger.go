@@ -0,0 +1,69 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/mchudgins/go/log"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+// Logger returns a unary interceptor which places a logger, derived from
+// base and tagged with the request's correlation ID and method, in the
+// context, so that log.FromContext is useful in handlers even without the
+// access logger.  The correlation ID is taken from the context, if an
+// earlier interceptor set it, or else from the request metadata; failing
+// both, a new one is generated.
+func Logger(base *zap.Logger) grpc.UnaryServerInterceptor {
+	corrHdr := strings.ToLower(correlationID.CORRID) // metadata uses lowercase keys
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		corrID := correlationID.FromContext(ctx)
+		if len(corrID) == 0 {
+			if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[corrHdr]) == 1 && correlationID.Valid(md[corrHdr][0]) {
+				corrID = md[corrHdr][0]
+			} else {
+				corrID = correlationID.NewID()
+			}
+			ctx = correlationID.NewContext(ctx, corrID)
+		}
+
+		ctx = log.NewContext(ctx, base.With(
+			zap.String(correlationID.RequestIDKey, corrID),
+			zap.String("method", info.FullMethod),
+		))
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	eccolog "github.com/mchudgins/go/log"
+)
+
+var rpcDeadlineClamped = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_server_deadline_clamped_total",
+		Help: "Number of requests whose deadline was absent or beyond the server's maximum.",
+	},
+	[]string{"method"},
+)
+
+func init() {
+	prometheus.MustRegister(rpcDeadlineClamped)
+}
+
+// MaxDeadline returns a unary interceptor which limits each request to
+// max: a client's deadline beyond max is shortened to it, and a request
+// without a deadline is given one.  The handler is not interrupted: once
+// it returns, if the shortened deadline has passed, its response is
+// replaced by a codes.DeadlineExceeded error.  Clamping is logged, at
+// debug level for a request without a deadline, via the request's logger
+// (see Logger).
+func MaxDeadline(max time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		limit := time.Now().Add(max)
+		deadline, ok := ctx.Deadline()
+		if ok && !deadline.After(limit) {
+			return handler(ctx, req)
+		}
+
+		rpcDeadlineClamped.WithLabelValues(info.FullMethod).Inc()
+		logger := eccolog.FromContext(ctx)
+		if ok {
+			logger.Info("client deadline exceeds the maximum; shortened",
+				zap.String("method", info.FullMethod),
+				zap.Duration("requested", time.Until(deadline)),
+				zap.Duration("max", max))
+		} else {
+			logger.Debug("request has no deadline; imposing the maximum",
+				zap.String("method", info.FullMethod),
+				zap.Duration("max", max))
+		}
+
+		ctx, cancel := context.WithDeadline(ctx, limit)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, status.Errorf(codes.DeadlineExceeded, "request exceeded the server's maximum deadline of %s", max)
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	eccolog "github.com/mchudgins/go/log"
+)
+
+func TestMaxDeadline(t *testing.T) {
+	interceptor := MaxDeadline(50 * time.Millisecond)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	ctx := eccolog.NewContext(context.Background(), zap.NewNop())
+
+	var remaining time.Duration
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok, "every request should have a deadline")
+		remaining = time.Until(deadline)
+		return "ok", nil
+	}
+
+	// no deadline: the maximum is imposed
+	resp, err := interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.LessOrEqual(t, remaining, 50*time.Millisecond)
+
+	// a longer deadline is shortened
+	long, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	_, err = interceptor(long, nil, info, handler)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, remaining, 50*time.Millisecond)
+
+	// a shorter deadline is untouched
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = interceptor(short, nil, info, handler)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, remaining, 10*time.Millisecond)
+
+	// a request outliving the maximum fails, even if it ignores the context
+	resp, err = interceptor(long, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return "late", nil
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright © 2022.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ *  Permission is hereby granted, free of charge, to any person obtaining a copy
+ *  of this software and associated documentation files (the "Software"), to deal
+ *  in the Software without restriction, including without limitation the rights
+ *  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ *  copies of the Software, and to permit persons to whom the Software is
+ *  furnished to do so, subject to the following conditions:
+ *
+ *  The above copyright notice and this permission notice shall be included in
+ *  all copies or substantial portions of the Software.
+ *
+ *  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ *  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ *  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ *  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ *  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ *  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ *  THE SOFTWARE.
+ *
+ */
+
+package grpcHelper
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	rpcRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_request_size_bytes",
+			Help:    "Size of unary gRPC request messages.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 9),
+		},
+		[]string{"method"},
+	)
+	rpcResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_response_size_bytes",
+			Help:    "Size of unary gRPC response messages.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 9),
+		},
+		[]string{"method"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rpcRequestSize)
+	prometheus.MustRegister(rpcResponseSize)
+}
+
+// MessageSize returns a unary interceptor which records the marshaled size
+// of request and response messages, by method.  Messages which are not
+// protobuf messages are not recorded.
+func MessageSize() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		labels := prometheus.Labels{"method": info.FullMethod}
+
+		if m, ok := req.(proto.Message); ok {
+			rpcRequestSize.With(labels).Observe(float64(proto.Size(m)))
+		}
+
+		resp, err := handler(ctx, req)
+
+		if m, ok := resp.(proto.Message); ok && err == nil {
+			rpcResponseSize.With(labels).Observe(float64(proto.Size(m)))
+		}
+
+		return resp, err
+	}
+}
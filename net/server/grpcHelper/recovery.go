@@ -28,33 +28,44 @@ import (
 	"runtime/debug"
 
 	"github.com/mchudgins/go/log"
-	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// Recovery converts a panic in the handler to an Aborted error,
+// logging up to log.DefaultPanicFrames frames of the panicking stack
 func Recovery(ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (resp interface{}, err error) {
 
-	logger := log.FromContext(ctx)
+	return RecoveryWithFrameLimit(log.DefaultPanicFrames)(ctx, req, info, handler)
+}
+
+// RecoveryWithFrameLimit returns a Recovery interceptor which logs
+// at most maxFrames frames of the panicking stack
+func RecoveryWithFrameLimit(maxFrames int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+
+		logger := log.FromContext(ctx)
 
-	defer func() {
-		switch r := recover(); r {
-		case nil:
-			break // do nothing. fall thru to return below
+		defer func() {
+			switch r := recover(); r {
+			case nil:
+				break // do nothing. fall thru to return below
 
-		default:
-			logger.Error("panic occurred",
-				zap.Any("error", r),
-				zap.ByteString("traceback", debug.Stack()))
-			err = status.Error(codes.Aborted, "Internal Server Error")
-		}
-	}()
+			default:
+				logger.Error("panic occurred", log.PanicFields(r, debug.Stack(), maxFrames)...)
+				err = status.Error(codes.Aborted, "Internal Server Error")
+			}
+		}()
 
-	resp, err = handler(ctx, req)
+		resp, err = handler(ctx, req)
 
-	return resp, err
+		return resp, err
+	}
 }
@@ -22,7 +22,11 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
+	"math/rand"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,8 +40,9 @@ import (
 	"google.golang.org/grpc/status"
 
 	eccolog "github.com/mchudgins/go/log"
+	"github.com/mchudgins/go/net/server/baggage"
 	"github.com/mchudgins/go/net/server/correlationID"
-	"github.com/mchudgins/go/net/server/requestTS"
+	"github.com/mchudgins/go/net/server/requestContext"
 	"github.com/mchudgins/go/net/server/user"
 )
 
@@ -63,7 +68,37 @@ func rpcClientInfo(ctx context.Context) (string, string, error) {
 		nil
 }
 
-func RPCEndpointLog(logger *zap.Logger, s string) grpc.UnaryServerInterceptor {
+// redactedValue replaces the values of sensitive metadata in the log
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactedMetadata lists the metadata keys (and HTTP headers)
+// whose values are never logged unless WithRedactedMetadata is used.
+// Binary ("-bin") metadata is always redacted.
+var DefaultRedactedMetadata = []string{"authorization", "cookie"}
+
+// acceptCorrelationID reports whether a correlation ID provided by a client
+// may be used, logging those which are rejected.  The rejected ID is quoted
+// & truncated, so it cannot forge log entries or flood the log.
+func acceptCorrelationID(logger *zap.Logger, id string) bool {
+	if correlationID.Valid(id) {
+		return true
+	}
+
+	if len(id) > correlationID.MaxLength {
+		id = id[:correlationID.MaxLength]
+	}
+	logger.Warn("rejected invalid correlation ID; a new one will be generated",
+		zap.String("rejected", strconv.QuoteToASCII(id)))
+
+	return false
+}
+
+// RPCEndpointLog returns an interceptor which logs each unary RPC.  The
+// values of sensitive metadata (DefaultRedactedMetadata, unless
+// overridden by WithRedactedMetadata) are replaced before logging.
+func RPCEndpointLog(logger *zap.Logger, s string, options ...AccessLogOption) grpc.UnaryServerInterceptor {
+	cfg := newAccessLogConfig(options...)
+
 	return func(ctx context.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
@@ -72,22 +107,37 @@ func RPCEndpointLog(logger *zap.Logger, s string) grpc.UnaryServerInterceptor {
 		start := time.Now()
 
 		mdIn, okIn := metadata.FromIncomingContext(ctx)
+		if !okIn {
+			// a direct call, e.g., from a test or an in-process client
+			mdIn = metadata.MD{}
+		}
 		remoteUser, remoteAddr, _ := rpcClientInfo(ctx)
 
 		// ensure a correlation ID exists
 		var corrID string
 		var corrHdr = strings.ToLower(correlationID.CORRID) // metadata uses lowercase keys
-		if okIn && len(mdIn[corrHdr]) == 1 {
+		if len(mdIn[corrHdr]) == 1 && acceptCorrelationID(logger, mdIn[corrHdr][0]) {
 			corrID = mdIn[corrHdr][0]
 		} else {
 			corrID = correlationID.NewID()
-			mdIn.Append(corrHdr, corrID)
+			mdIn.Set(corrHdr, corrID)
 			ctx = metadata.NewIncomingContext(ctx, mdIn)
 		}
-		// add the corrID to the context as well
-		ctx = correlationID.NewContext(ctx, corrID)
+		// add the corrID to the context as well, along with a timestamp,
+		// so we can correlate the request via the timestamp
+		ctx = requestContext.Update(ctx, func(rc *requestContext.RequestContext) {
+			rc.CorrelationID = corrID
+			rc.Start = start
+		})
+		if cfg.acceptsBaggage(remoteAddr) {
+			ctx = baggage.FromMetadata(ctx, mdIn)
+		}
 
-		//grpc.SendHeader(ctx, metadata.Pairs(correlationID.CORRID, corrID))
+		// return the correlation ID in the response header, rather than
+		// only at completion, so the caller can log it immediately
+		if err := grpc.SetHeader(ctx, metadata.Pairs(corrHdr, corrID)); err != nil {
+			logger.Debug("unable to set the correlation ID response header", zap.Error(err))
+		}
 
 		fields := make([]zapcore.Field, 0, 24+len(mdIn))
 		if len(s) > 0 {
@@ -99,36 +149,62 @@ func RPCEndpointLog(logger *zap.Logger, s string) grpc.UnaryServerInterceptor {
 			fields = append(fields, zap.String("remoteUser", remoteUser))
 		}
 		fields = append(fields, zap.String(correlationID.RequestIDKey, corrID))
-		if okIn {
-			fields = append(fields, zap.Any("requestHeaders", mdIn))
+		fields = append(fields, rpcTraceContextFields(mdIn)...)
+		if b := baggage.All(ctx); b != nil {
+			fields = append(fields, zap.Any("baggage", b))
+		}
+		if p, ok := peer.FromContext(ctx); ok && cfg.tlsDetails {
+			if tlsAuth, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				fields = append(fields, tlsFields(&tlsAuth.State)...)
+			}
+		}
+		if okIn && !cfg.noMetadata {
+			fields = append(fields, zap.Any("requestHeaders", cfg.redact(mdIn)))
 		}
 
 		ctx = eccolog.NewContext(ctx,
 			logger.With(
 				zap.String("requestID", corrID),
 			))
-		// tag this request with a timestamp, so we can correlate it via the timestamp
-		ctx = requestTS.NewContext(ctx, start)
 
+		var failed bool
+		var code codes.Code
 		defer func() {
+			if cfg.recorder != nil {
+				cfg.recorder.Record(RequestRecord{
+					Time:          start,
+					Method:        "gRPC",
+					Path:          info.FullMethod,
+					Status:        int(code),
+					Duration:      time.Since(start),
+					CorrelationID: corrID,
+				})
+			}
+
+			if !cfg.shouldLog(failed) {
+				return
+			}
+
 			mdOut, okOut := metadata.FromOutgoingContext(ctx)
 
 			end := time.Now()
 			elapsed := float64(end.Sub(start).Nanoseconds()) / 1000.0 // microSeconds
 			fields = append(fields, zap.Float64("duration", elapsed))
-			fields = append(fields, zap.String("time", start.Format("20060102030405.000000")))
-			if okOut {
-				fields = append(fields, zap.Any("responseHeaders", mdOut))
+			fields = append(fields, cfg.timeField(start))
+			if okOut && !cfg.noMetadata {
+				fields = append(fields, zap.Any("responseHeaders", cfg.redact(mdOut)))
 			}
 
-			logger.Info("rpc-request", fields...)
+			cfg.write(logger, "rpc-request", fields)
 		}()
 
 		rc, err := handler(ctx, req)
 		if err != nil {
+			failed = true
 			fields = append(fields, zap.Error(err))
 		}
-		fields = append(fields, zap.Uint32("status", uint32(status.Code(err))))
+		code = status.Code(err)
+		fields = append(fields, zap.Uint32("status", uint32(code)))
 
 		return rc, err
 	}
@@ -144,6 +220,205 @@ func getRequestURIFromRaw(rawURI string) string {
 	return rawURI[:i]
 }
 
+// AccessLogOption permits customization of the HTTPAccessLogger
+type AccessLogOption func(cfg *accessLogConfig)
+
+type accessLogConfig struct {
+	serverTiming bool
+	redacted     map[string]bool
+	sampleRate   float64
+	level        zapcore.Level
+	noMetadata   bool
+	headers      bool
+	timeField    func(t time.Time) zapcore.Field
+	recorder     *RequestRecorder
+	tlsDetails   bool
+	bodyMax      int64
+	bodyPaths    []string
+	baggage      bool
+	baggagePeers []netip.Prefix
+}
+
+func newAccessLogConfig(options ...AccessLogOption) *accessLogConfig {
+	cfg := &accessLogConfig{
+		sampleRate: 1,
+		level:      zapcore.InfoLevel,
+	}
+	WithTimeFormat(time.RFC3339Nano)(cfg)
+	WithRedactedMetadata(DefaultRedactedMetadata...)(cfg)
+	for _, o := range options {
+		o(cfg)
+	}
+
+	return cfg
+}
+
+// redact returns a copy of md in which the values of sensitive keys
+// have been replaced
+func (cfg *accessLogConfig) redact(md metadata.MD) metadata.MD {
+	out := make(metadata.MD, len(md))
+	for key, values := range md {
+		if cfg.redacted[key] || strings.HasSuffix(key, "-bin") {
+			values = []string{redactedValue}
+		}
+		out[key] = values
+	}
+
+	return out
+}
+
+// shouldLog reports whether a request should be logged.  Failed
+// requests are always logged; successful ones are sampled.
+func (cfg *accessLogConfig) shouldLog(failed bool) bool {
+	return failed || cfg.sampleRate >= 1 || rand.Float64() < cfg.sampleRate
+}
+
+// write logs the access log entry at the configured level
+func (cfg *accessLogConfig) write(logger *zap.Logger, msg string, fields []zapcore.Field) {
+	if ce := logger.Check(cfg.level, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// WithSampling logs only the given fraction (0 to 1) of successful
+// requests.  Failed requests -- those with a gRPC status other than OK
+// or an HTTP status of 500 or more -- are always logged.
+func WithSampling(fraction float64) AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.sampleRate = fraction }
+}
+
+// WithLogLevel sets the level at which requests are logged; the
+// default is Info
+func WithLogLevel(level zapcore.Level) AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.level = level }
+}
+
+// WithoutMetadata omits the request & response metadata from the
+// RPC access log
+func WithoutMetadata() AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.noMetadata = true }
+}
+
+// redactHeader returns h, or a copy of h in which the values of
+// sensitive headers have been replaced
+func (cfg *accessLogConfig) redactHeader(h http.Header) http.Header {
+	var out http.Header
+	for key := range h {
+		if cfg.redacted[strings.ToLower(key)] {
+			if out == nil {
+				out = h.Clone()
+			}
+			out[key] = []string{redactedValue}
+		}
+	}
+
+	if out == nil {
+		return h
+	}
+	return out
+}
+
+// WithHeaders includes the request & response headers in the HTTP
+// access log; by default they are omitted.  Headers named by
+// WithRedactedMetadata (by default, Authorization and Cookie) are
+// redacted.
+func WithHeaders() AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.headers = true }
+}
+
+// WithTimeFormat sets the layout of the "time" field, the time the
+// request was received; the default is time.RFC3339Nano
+func WithTimeFormat(layout string) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.timeField = func(t time.Time) zapcore.Field {
+			return zap.String("time", t.Format(layout))
+		}
+	}
+}
+
+// WithEpochMillisTime logs the "time" field as milliseconds since the
+// Unix epoch, matching the entry time of a logger using
+// zapcore.EpochMillisTimeEncoder
+func WithEpochMillisTime() AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.timeField = func(t time.Time) zapcore.Field {
+			return zap.Int64("time", t.UnixMilli())
+		}
+	}
+}
+
+// WithRedactedMetadata replaces the set of gRPC metadata keys and HTTP
+// headers whose values the access loggers will not log.  Binary ("-bin")
+// metadata is redacted regardless.
+func WithRedactedMetadata(keys ...string) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.redacted = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			cfg.redacted[strings.ToLower(key)] = true
+		}
+	}
+}
+
+// WithInboundBaggage accepts the baggage (see package baggage) of requests
+// from the given addresses or CIDR ranges, e.g., "10.0.0.0/8", or, if none
+// are given, from every caller.  By default, inbound baggage is ignored:
+// any client can set it, and it is logged and forwarded to downstream
+// services.  It panics if one of peers is invalid (see ParseTrustedProxies).
+func WithInboundBaggage(peers ...string) AccessLogOption {
+	prefixes, err := ParseTrustedProxies(peers...)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return func(cfg *accessLogConfig) {
+		cfg.baggage = true
+		cfg.baggagePeers = append(cfg.baggagePeers, prefixes...)
+	}
+}
+
+// acceptsBaggage reports whether the baggage of a request from remoteAddr
+// is accepted
+func (cfg *accessLogConfig) acceptsBaggage(remoteAddr string) bool {
+	return cfg.baggage && (len(cfg.baggagePeers) == 0 || trustedPeer(cfg.baggagePeers, remoteAddr))
+}
+
+// WithRequestRecorder adds every request, whether or not it is
+// logged, to rec
+func WithRequestRecorder(rec *RequestRecorder) AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.recorder = rec }
+}
+
+// WithTLSDetails includes, for requests received over TLS, the negotiated
+// version, cipher suite & server name (SNI) and the subject of the client's
+// certificate, if any, in the access logs; useful when diagnosing mTLS
+// problems
+func WithTLSDetails() AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.tlsDetails = true }
+}
+
+// tlsFields returns the fields logged by WithTLSDetails
+func tlsFields(state *tls.ConnectionState) []zapcore.Field {
+	fields := []zapcore.Field{
+		zap.String("tlsVersion", tls.VersionName(state.Version)),
+		zap.String("tlsCipherSuite", tls.CipherSuiteName(state.CipherSuite)),
+	}
+	if len(state.ServerName) > 0 {
+		fields = append(fields, zap.String("tlsServerName", state.ServerName))
+	}
+	if len(state.PeerCertificates) > 0 {
+		fields = append(fields, zap.String("tlsClientSubject", state.PeerCertificates[0].Subject.String()))
+	}
+
+	return fields
+}
+
+// WithServerTiming adds a Server-Timing response header reporting
+// the time, measured from the same start time as the access log entry,
+// spent processing the request prior to sending the response headers.
+func WithServerTiming() AccessLogOption {
+	return func(cfg *accessLogConfig) { cfg.serverTiming = true }
+}
+
 // HTTPAccessLogger returns a 'func(http.Handler) http.Handler' which
 // logs details about the request using a zap.Logger.
 //
@@ -155,7 +430,9 @@ func getRequestURIFromRaw(rawURI string) string {
 //
 // Note: If you want to use something other than zap, then simply write
 // a different http.Handler!
-func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
+func HTTPAccessLogger(log *zap.Logger, options ...AccessLogOption) func(http.Handler) http.Handler {
+	cfg := newAccessLogConfig(options...)
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -163,19 +440,26 @@ func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
 
 			// tag this request with a correlation ID, so we can troubleshoot it later, if necessary
 			corrID, fExisted := correlationID.FromRequest(r)
+			if fExisted && !acceptCorrelationID(log, corrID) {
+				fExisted = false
+			}
 			if !fExisted {
 				corrID = correlationID.NewID()
-				ctx := correlationID.NewContext(r.Context(), corrID)
-				r = r.WithContext(ctx)
-			} else { // ensure the correlationID is part of the request Context
-				if len(correlationID.FromContext(r.Context())) == 0 {
-					ctx := correlationID.NewContext(r.Context(), corrID)
-					r = r.WithContext(ctx)
+				if len(r.Header.Values(correlationID.CORRID)) > 0 {
+					r.Header.Set(correlationID.CORRID, corrID)
 				}
 			}
 
-			// tag this request with a timestamp, so we can correlate it via the timestamp
-			r = r.WithContext(requestTS.NewContext(r.Context(), start))
+			// and with a timestamp, so we can correlate it via the timestamp
+			r = r.WithContext(requestContext.Update(r.Context(), func(rc *requestContext.RequestContext) {
+				if !fExisted || len(rc.CorrelationID) == 0 {
+					rc.CorrelationID = corrID
+				}
+				rc.Start = start
+			}))
+			if cfg.acceptsBaggage(r.RemoteAddr) {
+				r = r.WithContext(baggage.FromHeader(r.Context(), r.Header))
+			}
 
 			// we want the status code from the handler chain,
 			// so inject an HTTPWriter, if one doesn't exist
@@ -187,6 +471,13 @@ func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
 			// ensure the caller gets a correlation ID in the response
 			lw.Header().Set(correlationID.CORRID, corrID)
 
+			if cfg.serverTiming {
+				lw.onWriteHeader(func(hdr http.Header) {
+					elapsed := float64(time.Since(start).Microseconds()) / 1000.0 // milliseconds
+					hdr.Add("Server-Timing", "total;dur="+strconv.FormatFloat(elapsed, 'f', 3, 64))
+				})
+			}
+
 			// save some values, in case the handler changes 'em
 			host := r.Host
 			url := getRequestURIFromRaw(r.RequestURI)
@@ -194,21 +485,48 @@ func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
 			method := r.Method
 			proto := r.Proto
 
-			fields := make([]zapcore.Field, 0, 20+len(r.Header))
-			requestHeaders := make(map[string]string)
-			for key := range r.Header {
-				requestHeaders[key] = r.Header.Get(key)
-			}
+			fields := make([]zapcore.Field, 0, 20)
 
 			fields = append(fields, zap.String("Host", host))
 			fields = append(fields, zap.String("URL", url))
 			fields = append(fields, zap.String("remoteIP", remoteAddr))
 			fields = append(fields, zap.String("method", method))
 			fields = append(fields, zap.String("proto", proto))
-			fields = append(fields, zap.Any("requestHeaders", requestHeaders))
+			if cfg.headers {
+				fields = append(fields, zap.Any("requestHeaders", cfg.redactHeader(r.Header)))
+			}
 			fields = append(fields, zap.String(correlationID.RequestIDKey, corrID))
+			fields = append(fields, httpTraceContextFields(r.Header)...)
+			if b := baggage.All(r.Context()); b != nil {
+				fields = append(fields, zap.Any("baggage", b))
+			}
+			if cfg.tlsDetails && r.TLS != nil {
+				fields = append(fields, tlsFields(r.TLS)...)
+			}
+			if cfg.logBody(r.URL.Path) {
+				body, err := TeeBody(r, cfg.bodyMax)
+				if err != nil {
+					log.Debug("unable to read the request body", zap.Error(err))
+				}
+				fields = append(fields, zap.ByteString("requestBody", body))
+			}
 
 			defer func() {
+				if cfg.recorder != nil {
+					cfg.recorder.Record(RequestRecord{
+						Time:          start,
+						Method:        method,
+						Path:          url,
+						Status:        lw.StatusCode(),
+						Duration:      time.Since(start),
+						CorrelationID: corrID,
+					})
+				}
+
+				if !cfg.shouldLog(lw.StatusCode() >= http.StatusInternalServerError) {
+					return
+				}
+
 				fields = append(fields, zap.Int("status", lw.StatusCode()))
 				fields = append(fields, zap.Int("length", lw.Length()))
 
@@ -219,20 +537,15 @@ func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
 				//					fields = append(fields, zap.String(correlationID.CORRID, idOut))
 				//				}
 
-				responseHeaders := make(map[string]string)
-				for key := range lw.Header() {
-					if key == correlationID.CORRID {
-						continue // tracking this header as a separate field in the parent struct
-					}
-					responseHeaders[key] = lw.Header().Get(key)
+				if cfg.headers {
+					fields = append(fields, zap.Any("responseHeaders", cfg.redactHeader(lw.Header())))
 				}
-				fields = append(fields, zap.Any("responseHeaders", responseHeaders))
 
 				end := time.Now()
 				elapsed := float64(end.Sub(start).Nanoseconds()) / 1000.0 // microSeconds
 
 				fields = append(fields, zap.Float64("duration", elapsed))
-				fields = append(fields, zap.String("time", start.Format("20060102030405.000000")))
+				fields = append(fields, cfg.timeField(start))
 
 				// who dat? Not all requests use X-Remote-User to xmit userid/username
 				// so look in the request context if X-Remote-User was not populated.
@@ -240,11 +553,11 @@ func HTTPAccessLogger(log *zap.Logger) func(http.Handler) http.Handler {
 				if len(uid) > 0 {
 					fields = append(fields, zap.String("user", uid))
 				}
-				log.With(fields...).Info("http-request")
+				cfg.write(log, "http-request", fields)
 			}()
 
 			h.ServeHTTP(lw, r)
-
+			lw.runHeaderHooks() // for a response with neither headers nor body written
 		})
 	}
 }
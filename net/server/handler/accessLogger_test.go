@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/mchudgins/go/net/server/baggage"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+func TestRPCEndpointLogWithoutMetadata(t *testing.T) {
+	interceptor := RPCEndpointLog(zap.NewNop(), "test")
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	assert.NotPanics(t, func() {
+		resp, err := interceptor(context.Background(), "request", info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				assert.NotEmpty(t, correlationID.FromContext(ctx))
+				return "response", nil
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, "response", resp)
+	})
+}
+
+func TestRPCEndpointLogRedactsMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []AccessLogOption
+		redacted []string // secrets which must not be logged
+		logged   []string // values which are logged as usual
+	}{
+		{name: "defaults",
+			redacted: []string{"Bearer secret-token", "session=secret-cookie", "secret-binary"},
+			logged:   []string{"api-key-value", "grpc-go/1.64.0"}},
+		{name: "configured",
+			options:  []AccessLogOption{WithRedactedMetadata("X-Api-Key")},
+			redacted: []string{"api-key-value", "secret-binary"},
+			logged:   []string{"Bearer secret-token", "session=secret-cookie", "grpc-go/1.64.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+
+			md := metadata.Pairs(
+				"authorization", "Bearer secret-token",
+				"cookie", "session=secret-cookie",
+				"x-api-key", "api-key-value",
+				"user-agent", "grpc-go/1.64.0",
+				"x-token-bin", "secret-binary",
+			)
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+			interceptor := RPCEndpointLog(logger, "test", tt.options...)
+			_, err := interceptor(ctx, "request", &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"},
+				func(ctx context.Context, req interface{}) (interface{}, error) { return "response", nil })
+			assert.NoError(t, err)
+
+			assert.Contains(t, buf.String(), redactedValue)
+			for _, secret := range tt.redacted {
+				assert.NotContains(t, buf.String(), secret)
+			}
+			for _, value := range tt.logged {
+				assert.Contains(t, buf.String(), value)
+			}
+		})
+	}
+}
+
+func TestHTTPAccessLoggerRedactsHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+
+	h := HTTPAccessLogger(logger, WithHeaders())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler still sees the values
+		assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Cookie", "session=secret-cookie")
+	r.Header.Set("Accept", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Contains(t, buf.String(), redactedValue)
+	assert.NotContains(t, buf.String(), "secret-token")
+	assert.NotContains(t, buf.String(), "secret-cookie")
+	assert.Contains(t, buf.String(), "application/json")
+}
+
+func TestHTTPAccessLoggerRejectsInvalidCorrelationID(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		accept bool
+	}{
+		{name: "uuid", id: "3f2504e0-4f89-41d3-9a0c-0305e82c3301", accept: true},
+		{name: "w3c trace id", id: "4bf92f3577b34da6a3ce929d0e0e4736", accept: true},
+		{name: "log injection", id: "abc\n{\"level\":\"error\"}"},
+		{name: "too long", id: strings.Repeat("a", correlationID.MaxLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := HTTPAccessLogger(zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = correlationID.FromContext(r.Context())
+				assert.Equal(t, seen, r.Header.Get(correlationID.CORRID))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(correlationID.CORRID, tt.id)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.True(t, correlationID.Valid(seen))
+			assert.Equal(t, tt.accept, seen == tt.id)
+			assert.Equal(t, seen, rr.Header().Get(correlationID.CORRID))
+		})
+	}
+}
+
+func TestHTTPAccessLoggerPropagatesBaggage(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []AccessLogOption
+		accept  bool
+	}{
+		{name: "ignored by default"},
+		{name: "any caller", options: []AccessLogOption{WithInboundBaggage()}, accept: true},
+		{name: "trusted peer", options: []AccessLogOption{WithInboundBaggage("10.0.0.0/8", "192.0.2.1")}, accept: true},
+		{name: "untrusted peer", options: []AccessLogOption{WithInboundBaggage("10.0.0.0/8")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downstream := make(http.Header)
+			h := HTTPAccessLogger(zap.NewNop(), tt.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant, ok := baggage.Get(r.Context(), "Tenant-ID")
+				assert.Equal(t, tt.accept, ok)
+				if ok {
+					assert.Equal(t, "acme", tenant)
+				}
+
+				baggage.ToHeader(r.Context(), downstream)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil) // from 192.0.2.1
+			r.Header.Set("Baggage-Tenant-Id", "acme")
+			r.Header.Set("Baggage-Bad-Value", "line\nbreak")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if tt.accept {
+				assert.Equal(t, "acme", downstream.Get("Baggage-Tenant-Id"))
+			} else {
+				assert.Empty(t, downstream)
+			}
+			assert.Empty(t, downstream.Get("Baggage-Bad-Value"))
+		})
+	}
+
+	assert.Panics(t, func() { WithInboundBaggage("not-an-address") })
+}
+
+func TestRPCEndpointLogBaggage(t *testing.T) {
+	call := func(peerAddr string, options ...AccessLogOption) (tenant string, ok bool) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("baggage-tenant-id", "acme"))
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerAddr), Port: 50000}})
+
+		interceptor := RPCEndpointLog(zap.NewNop(), "test", options...)
+		_, err := interceptor(ctx, "request", &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				tenant, ok = baggage.Get(ctx, "tenant-id")
+				return "response", nil
+			})
+		assert.NoError(t, err)
+		return tenant, ok
+	}
+
+	_, ok := call("10.1.2.3")
+	assert.False(t, ok, "baggage should be ignored by default")
+
+	tenant, ok := call("10.1.2.3", WithInboundBaggage("10.0.0.0/8"))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+
+	_, ok = call("203.0.113.9", WithInboundBaggage("10.0.0.0/8"))
+	assert.False(t, ok, "baggage from an untrusted peer should be ignored")
+}
+
+func TestHTTPAccessLoggerServerTiming(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{name: "explicit status", status: http.StatusCreated,
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) }},
+		{name: "body only", status: http.StatusOK,
+			handler: func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) }},
+		{name: "implicit 200", status: http.StatusOK,
+			handler: func(w http.ResponseWriter, r *http.Request) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := HTTPAccessLogger(zap.NewNop(), WithServerTiming())(tt.handler)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.status, rr.Code)
+			timing := rr.Header().Values("Server-Timing")
+			if assert.Len(t, timing, 1) {
+				assert.True(t, strings.HasPrefix(timing[0], "total;dur="), timing[0])
+			}
+		})
+	}
+}
+
+func TestHTTPAccessLoggerTLSDetails(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		ServerName:       "api.example.com",
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "client"}}},
+	}
+
+	HTTPAccessLogger(logger)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+	assert.NotContains(t, buf.String(), "tlsVersion")
+
+	buf.Reset()
+	HTTPAccessLogger(logger, WithTLSDetails())(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Contains(t, buf.String(), `"tlsVersion":"TLS 1.3"`)
+	assert.Contains(t, buf.String(), `"tlsCipherSuite":"TLS_AES_128_GCM_SHA256"`)
+	assert.Contains(t, buf.String(), `"tlsServerName":"api.example.com"`)
+	assert.Contains(t, buf.String(), `"tlsClientSubject":"CN=client"`)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", spanID)
+	assert.True(t, sampled)
+
+	_, _, sampled, ok = parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.True(t, ok, "later versions may append fields")
+	assert.False(t, sampled)
+
+	// other flags may be set alongside the sampled flag
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0b")
+	assert.True(t, ok)
+	assert.True(t, sampled)
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0a")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+
+	for _, malformed := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		_, _, _, ok := parseTraceparent(malformed)
+		assert.False(t, ok, malformed)
+	}
+}
+
+func TestAccessLoggerTraceContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(TraceparentHeader, traceparent)
+	r.Header.Add(TracestateHeader, "congo=t61rcWkgMzE")
+	r.Header.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+	HTTPAccessLogger(logger)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Contains(t, buf.String(), `"traceID":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, buf.String(), `"spanID":"00f067aa0ba902b7"`)
+	assert.Contains(t, buf.String(), `"traceSampled":true`)
+	assert.Contains(t, buf.String(), `"traceState":"congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"`)
+
+	// malformed headers are ignored
+	buf.Reset()
+	r.Header.Set(TraceparentHeader, "garbage")
+	HTTPAccessLogger(logger)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Contains(t, buf.String(), `"status":404`)
+	assert.NotContains(t, buf.String(), "traceID")
+	assert.NotContains(t, buf.String(), "traceState")
+
+	buf.Reset()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(TraceparentHeader, traceparent))
+	_, err := RPCEndpointLog(logger, "test")(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"traceID":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, buf.String(), `"spanID":"00f067aa0ba902b7"`)
+}
+
+func benchmarkHTTPAccessLogger(b *testing.B, options ...AccessLogOption) {
+	h := HTTPAccessLogger(zap.NewNop(), options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/benchmark", nil)
+	r.Header.Set("Accept", "text/plain")
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	r.Header.Set("User-Agent", "benchmark/1.0")
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+// BenchmarkHTTPAccessLogger measures the default path, which does not
+// copy the request & response headers
+func BenchmarkHTTPAccessLogger(b *testing.B) {
+	benchmarkHTTPAccessLogger(b)
+}
+
+func BenchmarkHTTPAccessLoggerWithHeaders(b *testing.B) {
+	benchmarkHTTPAccessLogger(b, WithHeaders())
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchudgins/go/net/server/baggage"
+	"github.com/mchudgins/go/net/server/budget"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+const (
+	// RequestTimeoutHeader carries the caller's remaining time budget to downstream HTTP services
+	RequestTimeoutHeader = budget.RequestTimeoutHeader
+)
+
+// WithRequestBudget returns middleware which imposes a deadline of d
+// on requests whose context does not already carry one.
+func WithRequestBudget(d time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); !ok && d > 0 {
+				ctx, cancel := context.WithTimeout(r.Context(), d)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+type deadlineConfig struct {
+	header string
+}
+
+// DeadlineOption customizes RequestDeadline & RPCRequestDeadline
+type DeadlineOption func(*deadlineConfig)
+
+// WithDeadlineHeader reads the caller's timeout from the named header
+// (or gRPC metadata key), rather than X-Request-Timeout
+func WithDeadlineHeader(name string) DeadlineOption {
+	return func(cfg *deadlineConfig) { cfg.header = name }
+}
+
+func newDeadlineConfig(options ...DeadlineOption) *deadlineConfig {
+	cfg := &deadlineConfig{header: RequestTimeoutHeader}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return cfg
+}
+
+// callerTimeout parses the caller's timeout, e.g., "2s" or "1.5s", capping
+// it at max.  ok is false if the caller did not provide a valid timeout.
+func callerTimeout(value string, max time.Duration) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, false
+	}
+
+	if max > 0 && timeout > max {
+		timeout = max
+	}
+
+	return timeout, true
+}
+
+// RequestDeadline returns middleware which imposes the deadline a caller
+// requests in the X-Request-Timeout header, capped at max, so the server
+// doesn't keep working on a request after the caller has given up.  The
+// handler is not interrupted, so it should heed its context; if it returns
+// after the deadline without having responded, the response is 504 Gateway
+// Timeout.  Requests without the header are unaffected.
+func RequestDeadline(max time.Duration, options ...DeadlineOption) func(http.Handler) http.Handler {
+	cfg := newDeadlineConfig(options...)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, ok := callerTimeout(r.Header.Get(cfg.header), max)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			lw, ok := w.(*HTTPWriter)
+			if !ok {
+				lw = NewHTTPWriter(w)
+			}
+
+			h.ServeHTTP(lw, r.WithContext(ctx))
+
+			// only if the handler gave up without responding
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && lw.StatusCode() == 0 {
+				http.Error(lw, "request deadline exceeded", http.StatusGatewayTimeout)
+			}
+		})
+	}
+}
+
+// RPCRequestDeadline is the gRPC counterpart of RequestDeadline, reading
+// the caller's timeout from the x-request-timeout metadata.  Calls which
+// exceed the deadline fail with codes.DeadlineExceeded.
+func RPCRequestDeadline(max time.Duration, options ...DeadlineOption) grpc.UnaryServerInterceptor {
+	cfg := newDeadlineConfig(options...)
+	key := strings.ToLower(cfg.header) // metadata uses lowercase keys
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		var value string
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[key]) > 0 {
+			value = md[key][0]
+		}
+
+		timeout, ok := callerTimeout(value, max)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && (err == nil || errors.Is(err, context.DeadlineExceeded)) {
+			return nil, status.Error(codes.DeadlineExceeded, "request deadline exceeded")
+		}
+
+		return resp, err
+	}
+}
+
+// DownstreamContext derives a child context whose deadline is the given
+// fraction of the time remaining in ctx (see budget.DownstreamContext)
+func DownstreamContext(ctx context.Context, fraction float64) (context.Context, context.CancelFunc) {
+	return budget.DownstreamContext(ctx, fraction)
+}
+
+// RPCBudgetClientInterceptor returns a client interceptor which shortens the
+// deadline of outgoing calls to the given fraction of the remaining budget
+// and propagates the correlation ID & baggage as metadata.  gRPC itself transmits the
+// resulting deadline to the server as the grpc-timeout header.
+func RPCBudgetClientInterceptor(fraction float64) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		ctx, cancel := DownstreamContext(ctx, fraction)
+		defer cancel()
+
+		if corrID := correlationID.FromContext(ctx); len(corrID) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, correlationID.CORRID, corrID)
+		}
+		ctx = baggage.AppendToOutgoingContext(ctx)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
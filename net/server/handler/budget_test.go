@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// slowHandler waits for its context to expire, or for 100ms
+func slowHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(100 * time.Millisecond):
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		max    time.Duration
+		expect int
+	}{
+		{name: "no header", expect: http.StatusOK},
+		{name: "invalid header", header: "soon", expect: http.StatusOK},
+		{name: "caller deadline", header: "10ms", expect: http.StatusGatewayTimeout},
+		{name: "capped", header: "1h", max: 10 * time.Millisecond, expect: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequestDeadline(tt.max, WithDeadlineHeader("X-Timeout"))(http.HandlerFunc(slowHandler))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.header) > 0 {
+				r.Header.Set("X-Timeout", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.expect, rr.Code)
+		})
+	}
+}
+
+func TestRPCRequestDeadline(t *testing.T) {
+	interceptor := RPCRequestDeadline(10 * time.Millisecond)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	slow := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestTimeoutHeader, "1h"))
+	_, err := interceptor(ctx, "request", info, slow)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	resp, err := interceptor(context.Background(), "request", info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, ok := ctx.Deadline()
+			assert.False(t, ok, "calls without the metadata should be unaffected")
+			return "response", nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, "response", resp)
+}
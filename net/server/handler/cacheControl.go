@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl returns middleware which sets the Cache-Control
+// response header to directive, e.g., "no-store" or "public, max-age=60"
+func CacheControl(directive string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", directive)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NoStore returns middleware which prevents caching of the response,
+// for endpoints which return sensitive or per-request data
+func NoStore() func(http.Handler) http.Handler {
+	return CacheControl("no-store")
+}
+
+// CachePublic returns middleware which permits any cache to hold the
+// response for maxAge
+func CachePublic(maxAge time.Duration) func(http.Handler) http.Handler {
+	return CacheControl("public, max-age=" + strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// AddVary adds each of names to the Vary header of h, unless the header
+// already lists it
+func AddVary(h http.Header, names ...string) {
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if !varies(h, name) {
+			h.Add("Vary", name)
+		}
+	}
+}
+
+func varies(h http.Header, name string) bool {
+	for _, value := range h.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Vary returns middleware which adds names to the Vary response header
+func Vary(names ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddVary(w.Header(), names...)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"compress/gzip"
+	"net/http"
+
+	"github.com/gorilla/handlers"
+	"github.com/justinas/alice"
+	"go.uber.org/zap"
+)
+
+type chainConfig struct {
+	accessLogOptions []AccessLogOption
+	clientCert       []ClientCertOption
+	clientCertUser   bool
+	drainer          *Drainer
+	hostname         string
+	compress         bool
+	compressLevel    int
+	compressMinSize  int
+	compressTypes    []string
+	noMetrics        bool
+	metricsOptions   []MetricsOption
+	requireHTTPS     bool
+	httpsMode        RedirectOrReject
+	httpsOptions     []HTTPSOption
+}
+
+// ChainOption customizes the chain built by DefaultChain
+type ChainOption func(*chainConfig)
+
+// WithAccessLogOptions passes options to the chain's HTTPAccessLogger
+func WithAccessLogOptions(options ...AccessLogOption) ChainOption {
+	return func(cfg *chainConfig) {
+		cfg.accessLogOptions = append(cfg.accessLogOptions, options...)
+	}
+}
+
+// WithClientCertUser identifies users by their client certificates
+// (see ClientCertUser)
+func WithClientCertUser(options ...ClientCertOption) ChainOption {
+	return func(cfg *chainConfig) {
+		cfg.clientCertUser = true
+		cfg.clientCert = append(cfg.clientCert, options...)
+	}
+}
+
+// WithDrainer rejects new requests once d begins draining
+func WithDrainer(d *Drainer) ChainOption {
+	return func(cfg *chainConfig) { cfg.drainer = d }
+}
+
+// WithCanonicalHost permanently redirects requests for any other
+// host name to hostname
+func WithCanonicalHost(hostname string) ChainOption {
+	return func(cfg *chainConfig) { cfg.hostname = hostname }
+}
+
+// WithRequireHTTPS allows only requests made over TLS (see RequireHTTPS).
+// With WithCanonicalHost, plaintext requests are redirected to https at
+// the canonical host in a single hop.
+func WithRequireHTTPS(mode RedirectOrReject, options ...HTTPSOption) ChainOption {
+	return func(cfg *chainConfig) {
+		cfg.requireHTTPS = true
+		cfg.httpsMode = mode
+		cfg.httpsOptions = append(cfg.httpsOptions, options...)
+	}
+}
+
+// WithCompression compresses responses for clients which accept it,
+// using the defaults of WithCompressionOptions
+func WithCompression() ChainOption {
+	return WithCompressionOptions(gzip.DefaultCompression, DefaultCompressMinSize, DefaultCompressContentTypes)
+}
+
+// WithCompressionOptions compresses responses of at least minSize bytes
+// and of the given content types, at the given gzip level (see Compress)
+func WithCompressionOptions(level, minSize int, contentTypes []string) ChainOption {
+	return func(cfg *chainConfig) {
+		cfg.compress = true
+		cfg.compressLevel = level
+		cfg.compressMinSize = minSize
+		cfg.compressTypes = contentTypes
+	}
+}
+
+// WithoutMetrics omits the HTTPMetricsCollector from the chain
+func WithoutMetrics() ChainOption {
+	return func(cfg *chainConfig) { cfg.noMetrics = true }
+}
+
+// WithMetricsOptions passes options to the chain's HTTPMetricsCollector,
+// e.g., WithUserAgentMetrics
+func WithMetricsOptions(options ...MetricsOption) ChainOption {
+	return func(cfg *chainConfig) {
+		cfg.metricsOptions = append(cfg.metricsOptions, options...)
+	}
+}
+
+// DefaultChain returns the middleware chain which server.Run wraps around
+// the HTTP handler, for serving a handler without server.Run, e.g., in a
+// test or a Lambda.  In order, outermost first, the chain contains:
+//
+//   - HTTPMetricsCollector, which records the prometheus request metrics,
+//     unless WithoutMetrics was provided
+//   - ClientCertUser, if WithClientCertUser was provided
+//   - HTTPAccessLogger, which assigns the correlation ID & logs the request
+//   - the rejection of requests without a client certificate, if
+//     RequireClientCert was passed to WithClientCertUser
+//   - the Drainer's Handler, if WithDrainer was provided
+//   - RequireHTTPS, if WithRequireHTTPS was provided
+//   - a canonical host redirect, if WithCanonicalHost was provided
+//   - response compression, if WithCompression or WithCompressionOptions
+//     was provided
+func DefaultChain(logger *zap.Logger, opts ...ChainOption) alice.Chain {
+	cfg := &chainConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	chain := alice.New()
+
+	if !cfg.noMetrics {
+		chain = chain.Append(NewHTTPMetricsCollector(cfg.metricsOptions...))
+	}
+
+	// the identity is extracted ahead of the access logger, so that it's
+	// logged, but enforced within it, so that rejections are logged, too
+	var clientCert *clientCertConfig
+	if cfg.clientCertUser {
+		clientCert = newClientCertConfig(cfg.clientCert...)
+		chain = chain.Append(clientCert.identify)
+	}
+
+	chain = chain.Append(HTTPAccessLogger(logger, cfg.accessLogOptions...))
+
+	if clientCert != nil && clientCert.required {
+		chain = chain.Append(requireUser)
+	}
+
+	if cfg.drainer != nil {
+		chain = chain.Append(cfg.drainer.Handler)
+	}
+
+	if cfg.requireHTTPS {
+		options := cfg.httpsOptions
+		if len(cfg.hostname) > 0 {
+			options = append(options[:len(options):len(options)], WithHTTPSHost(cfg.hostname))
+		}
+		chain = chain.Append(RequireHTTPS(cfg.httpsMode, options...))
+	}
+
+	if len(cfg.hostname) > 0 {
+		chain = chain.Append(handlers.CanonicalHost(cfg.hostname, http.StatusPermanentRedirect))
+	}
+
+	if cfg.compress {
+		chain = chain.Append(Compress(cfg.compressLevel, cfg.compressMinSize, cfg.compressTypes))
+	}
+
+	return chain
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/mchudgins/go/net/server/user"
+)
+
+// CertIdentity names the holder of a verified client certificate
+type CertIdentity func(cert *x509.Certificate) string
+
+// CommonName identifies a client by its certificate's subject CN
+func CommonName(cert *x509.Certificate) string { return cert.Subject.CommonName }
+
+// URISAN identifies a client by its certificate's first URI subject
+// alternative name, e.g., a SPIFFE ID
+func URISAN(cert *x509.Certificate) string {
+	if len(cert.URIs) == 0 {
+		return ""
+	}
+	return cert.URIs[0].String()
+}
+
+// DNSSAN identifies a client by its certificate's first DNS subject
+// alternative name
+func DNSSAN(cert *x509.Certificate) string {
+	if len(cert.DNSNames) == 0 {
+		return ""
+	}
+	return cert.DNSNames[0]
+}
+
+type clientCertConfig struct {
+	identity CertIdentity
+	required bool
+}
+
+// ClientCertOption customizes ClientCertUser
+type ClientCertOption func(*clientCertConfig)
+
+// WithCertIdentity names clients with fn rather than by their CN
+func WithCertIdentity(fn CertIdentity) ClientCertOption {
+	return func(cfg *clientCertConfig) { cfg.identity = fn }
+}
+
+// RequireClientCert rejects requests without a verified client
+// certificate (or whose certificate yields no identity) with 401
+// Unauthorized
+func RequireClientCert() ClientCertOption {
+	return func(cfg *clientCertConfig) { cfg.required = true }
+}
+
+// ClientCertUser returns middleware which stores the identity of the
+// client's verified certificate (by default, its CN) in the request
+// context via user.NewContext -- the HTTP counterpart of
+// grpcHelper.CallerInfo.  Certificates are requested by the server with
+// WithRequestClientCert.  Install it ahead of HTTPAccessLogger for the
+// access log to record the identity.  DefaultChain does so, but enforces
+// RequireClientCert inside the logger, so that rejections are logged.
+func ClientCertUser(options ...ClientCertOption) func(http.Handler) http.Handler {
+	cfg := newClientCertConfig(options...)
+
+	return func(h http.Handler) http.Handler {
+		if cfg.required {
+			h = requireUser(h)
+		}
+		return cfg.identify(h)
+	}
+}
+
+func newClientCertConfig(options ...ClientCertOption) *clientCertConfig {
+	cfg := &clientCertConfig{identity: CommonName}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return cfg
+}
+
+// identify stores the identity of the client's certificate, if any, in
+// the request context
+func (cfg *clientCertConfig) identify(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id string
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			id = cfg.identity(r.TLS.VerifiedChains[0][0])
+		}
+
+		if len(id) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(user.NewContext(r.Context(), id)))
+	})
+}
+
+// requireUser rejects requests which identify did not attribute to a user
+func requireUser(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(user.FromContext(r.Context())) == 0 {
+			http.Error(w, "a verified client certificate is required", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
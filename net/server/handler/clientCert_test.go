@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mchudgins/go/net/server/user"
+)
+
+func TestClientCertUser(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, URIs: []*url.URL{spiffe}}
+
+	tests := []struct {
+		name    string
+		options []ClientCertOption
+		cert    *x509.Certificate
+		expect  int
+		user    string
+	}{
+		{name: "common name", cert: cert, expect: http.StatusOK, user: "billing"},
+		{name: "URI SAN", options: []ClientCertOption{WithCertIdentity(URISAN)}, cert: cert,
+			expect: http.StatusOK, user: "spiffe://example.org/billing"},
+		{name: "optional & absent", expect: http.StatusOK},
+		{name: "required & absent", options: []ClientCertOption{RequireClientCert()}, expect: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := ClientCertUser(tt.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = user.FromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "https://localhost/", nil)
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.expect, rr.Code)
+			assert.Equal(t, tt.user, seen)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the smallest response compressed by default;
+// below it, compression costs more than it saves
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressContentTypes are the media types compressed by default.
+// Already-compressed content, e.g., images & archives, is excluded.
+var DefaultCompressContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/x-ndjson",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Compress returns middleware which gzips responses for clients which accept
+// it, at the given level (gzip.DefaultCompression if level is invalid),
+// when the response is at least minSize bytes and its Content-Type is in
+// contentTypes.  An entry ending in "/", e.g., "text/", matches every
+// subtype; the others must match exactly.  A response which has already
+// set a Content-Encoding is never compressed.
+func Compress(level, minSize int, contentTypes []string) func(http.Handler) http.Handler {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		level = gzip.DefaultCompression
+	}
+
+	cfg := &compressConfig{
+		minSize:      minSize,
+		contentTypes: contentTypes,
+	}
+	cfg.pool.New = func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: cfg}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+type compressConfig struct {
+	minSize      int
+	contentTypes []string
+	pool         sync.Pool
+}
+
+func (cfg *compressConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range cfg.contentTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptsGzip reports whether an Accept-Encoding header permits gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of the response until it can decide,
+// from the Content-Type & size, whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	cfg     *compressConfig
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) < cw.cfg.minSize {
+			return len(data), nil
+		}
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if cw.gz != nil {
+		return cw.gz.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// decide sends the headers & buffered data, compressing them if the
+// response qualifies.  A flush commits the response regardless of its size.
+func (cw *compressWriter) decide(flushing bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if len(h.Get("Content-Type")) == 0 && len(cw.buf) > 0 {
+		// once compressed, the server can no longer sniff the content
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if (flushing || len(cw.buf) >= cw.cfg.minSize) &&
+		len(cw.buf) > 0 &&
+		cw.status != http.StatusPartialContent &&
+		len(h.Get("Content-Encoding")) == 0 &&
+		cw.cfg.compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		AddVary(h, "Accept-Encoding")
+		h.Del("Content-Length")
+
+		cw.gz = cw.cfg.pool.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+// Flush sends any buffered data to the client, so that streaming
+// handlers work through the middleware
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		_ = cw.decide(false)
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Close()
+		cw.cfg.pool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("compressible ", 200)
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		acceptEncoding string
+		compressed     bool
+	}{
+		{name: "large json", contentType: "application/json; charset=utf-8", body: large, acceptEncoding: "gzip", compressed: true},
+		{name: "large text", contentType: "text/html", body: large, acceptEncoding: "br, gzip;q=0.5", compressed: true},
+		{name: "sniffed text", body: large, acceptEncoding: "gzip", compressed: true},
+		{name: "tiny json", contentType: "application/json", body: `{"ok":true}`, acceptEncoding: "gzip"},
+		{name: "jpeg", contentType: "image/jpeg", body: large, acceptEncoding: "gzip"},
+		{name: "not accepted", contentType: "text/plain", body: large, acceptEncoding: "gzip;q=0"},
+		{name: "no accept-encoding", contentType: "text/plain", body: large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(gzip.BestSpeed, DefaultCompressMinSize, DefaultCompressContentTypes)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if len(tt.contentType) > 0 {
+						w.Header().Set("Content-Type", tt.contentType)
+					}
+					w.WriteHeader(http.StatusCreated)
+					// write in pieces, so the decision spans several writes
+					for i := 0; i < len(tt.body); i += 100 {
+						_, _ = io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+					}
+				}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.acceptEncoding) > 0 {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			if !tt.compressed {
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+				assert.Equal(t, tt.body, rr.Body.String())
+				return
+			}
+
+			assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			assert.Less(t, rr.Body.Len(), len(tt.body))
+			gz, err := gzip.NewReader(rr.Body)
+			if assert.NoError(t, err) {
+				body, err := io.ReadAll(gz)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestCompressVary(t *testing.T) {
+	h := Compress(gzip.BestSpeed, DefaultCompressMinSize, DefaultCompressContentTypes)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// e.g., Vary middleware applied inside Compress
+			w.Header().Set("Vary", "accept-encoding, Origin")
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, strings.Repeat("compressible ", 200))
+		}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"accept-encoding, Origin"}, rr.Header().Values("Vary"))
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsMaxAge is how long a browser may cache the result of a preflight request
+const corsMaxAge = 10 * time.Minute
+
+// CORS returns middleware which permits cross-origin requests from each of
+// origins, answering preflight requests itself.  Credentialed requests are
+// permitted only for explicitly listed origins; an origin of "*" permits any
+// site to make simple, uncredentialed requests, since browsers reject a
+// wildcard origin on a credentialed response.
+func CORS(origins ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddVary(w.Header(), "Origin")
+
+			origin := r.Header.Get("Origin")
+			switch {
+			case len(origin) == 0:
+				// not a cross-origin request
+				h.ServeHTTP(w, r)
+				return
+
+			case allowed[origin]:
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+			case allowed["*"]:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+
+			default:
+				// let the browser enforce the same-origin policy
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || len(method) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			// preflight
+			AddVary(w.Header(), "Access-Control-Request-Method", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", method)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); len(headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name         string
+		origins      []string
+		origin       string
+		preflight    bool
+		expect       int
+		expectOrigin string
+		expectCreds  bool
+	}{
+		{name: "same origin", origins: []string{"https://ops.example.com"}, expect: http.StatusOK},
+		{name: "listed origin", origins: []string{"https://ops.example.com"}, origin: "https://ops.example.com",
+			expect: http.StatusOK, expectOrigin: "https://ops.example.com", expectCreds: true},
+		{name: "unlisted origin", origins: []string{"https://ops.example.com"}, origin: "https://evil.example.com",
+			expect: http.StatusOK},
+		{name: "wildcard never permits credentials", origins: []string{"*"}, origin: "https://evil.example.com",
+			expect: http.StatusOK, expectOrigin: "*"},
+		{name: "preflight", origins: []string{"https://ops.example.com"}, origin: "https://ops.example.com", preflight: true,
+			expect: http.StatusNoContent, expectOrigin: "https://ops.example.com", expectCreds: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := CORS(tt.origins...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/hystrix", nil)
+			if len(tt.origin) > 0 {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Method = http.MethodOptions
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				req.Header.Set("Access-Control-Request-Headers", "Authorization")
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expect, rr.Code)
+			assert.Equal(t, tt.expectOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectCreds, rr.Header().Get("Access-Control-Allow-Credentials") == "true")
+			assert.Contains(t, rr.Header().Values("Vary"), "Origin")
+			if tt.preflight {
+				assert.Equal(t, "Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	eccolog "github.com/mchudgins/go/log"
+)
+
+var deprecatedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "deprecated_requests_total",
+		Help: "Number of requests for deprecated HTTP endpoints & RPC methods.",
+	},
+	[]string{"endpoint"},
+)
+
+func init() {
+	prometheus.MustRegister(deprecatedRequests)
+}
+
+// deprecation describes a deprecated endpoint to its clients
+type deprecation struct {
+	sunset    time.Time
+	successor string
+}
+
+// headers returns the Deprecation, Sunset (RFC 8594) & Link headers.
+// Metadata keys are lowercase, so the names are, too.
+func (d deprecation) headers() map[string]string {
+	h := map[string]string{"deprecation": "true"}
+	if !d.sunset.IsZero() {
+		h["sunset"] = d.sunset.UTC().Format(http.TimeFormat)
+	}
+	if len(d.successor) > 0 {
+		h["link"] = "<" + d.successor + `>; rel="successor-version"`
+	}
+
+	return h
+}
+
+func (d deprecation) record(ctx context.Context, endpoint string, fields ...zap.Field) {
+	deprecatedRequests.WithLabelValues(endpoint).Inc()
+
+	fields = append(fields,
+		zap.Bool("deprecated", true),
+		zap.String("endpoint", endpoint))
+	if !d.sunset.IsZero() {
+		fields = append(fields, zap.Time("sunset", d.sunset))
+	}
+	if len(d.successor) > 0 {
+		fields = append(fields, zap.String("successor", d.successor))
+	}
+	eccolog.FromContext(ctx).Warn("deprecated endpoint requested", fields...)
+}
+
+// Deprecated returns middleware which marks the endpoint it wraps as
+// deprecated: responses carry the Deprecation and, if sunset is not zero,
+// Sunset headers, and a Link to successor, if provided.  Each request is
+// logged as a warning and counted in deprecated_requests_total, labelled
+// with endpoint, e.g., the route's pattern, rather than the request's path,
+// which would give every order, say, its own time series.
+func Deprecated(endpoint string, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	d := deprecation{sunset: sunset, successor: successor}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range d.headers() {
+				w.Header().Set(k, v)
+			}
+			d.record(r.Context(), endpoint, zap.String("path", r.URL.Path))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RPCDeprecated returns an interceptor which marks the given methods,
+// e.g., "/pkg.Service/Method" (or every method, if none are given), as
+// deprecated, just as Deprecated does, but with response header metadata
+func RPCDeprecated(sunset time.Time, successor string, methods ...string) grpc.UnaryServerInterceptor {
+	d := deprecation{sunset: sunset, successor: successor}
+
+	deprecated := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		deprecated[method] = true
+	}
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if len(deprecated) > 0 && !deprecated[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		if err := grpc.SetHeader(ctx, metadata.New(d.headers())); err != nil {
+			eccolog.FromContext(ctx).Debug("unable to set the deprecation headers", zap.Error(err))
+		}
+		d.record(ctx, info.FullMethod)
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	eccolog "github.com/mchudgins/go/log"
+)
+
+func deprecatedCount(t *testing.T, endpoint string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "deprecated_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() == endpoint {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	h := Deprecated("/v1/orders/{id}", sunset, "/v2/orders")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	before := deprecatedCount(t, "/v1/orders/{id}")
+	for _, path := range []string{"/v1/orders/1", "/v1/orders/2"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r = r.WithContext(eccolog.NewContext(r.Context(), zap.NewNop()))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "true", rr.Header().Get("Deprecation"))
+		assert.Equal(t, "Tue, 01 Jan 2030 00:00:00 GMT", rr.Header().Get("Sunset"))
+		assert.Equal(t, `</v2/orders>; rel="successor-version"`, rr.Header().Get("Link"))
+	}
+
+	// the requests are counted by endpoint, not by path
+	assert.Equal(t, before+2, deprecatedCount(t, "/v1/orders/{id}"))
+	assert.Zero(t, deprecatedCount(t, "/v1/orders/1"))
+}
+
+// headerStream records the header metadata set by an interceptor
+type headerStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return s.method }
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+func (s *headerStream) SetTrailer(metadata.MD) error    { return nil }
+
+func TestRPCDeprecated(t *testing.T) {
+	const (
+		old     = "/orders.Orders/Get"
+		current = "/orders.Orders/List"
+	)
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	interceptor := RPCDeprecated(sunset, "/orders.v2.Orders/Get", old)
+
+	call := func(method string) metadata.MD {
+		stream := &headerStream{method: method}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		ctx = eccolog.NewContext(ctx, zap.NewNop())
+
+		resp, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return "resp", nil })
+		assert.NoError(t, err)
+		assert.Equal(t, "resp", resp)
+
+		return stream.header
+	}
+
+	before := deprecatedCount(t, old)
+	md := call(old)
+	assert.Equal(t, []string{"true"}, md.Get("deprecation"))
+	assert.Equal(t, []string{"Tue, 01 Jan 2030 00:00:00 GMT"}, md.Get("sunset"))
+	assert.Equal(t, []string{`</orders.v2.Orders/Get>; rel="successor-version"`}, md.Get("link"))
+	assert.Equal(t, before+1, deprecatedCount(t, old))
+
+	// methods which are not deprecated pass through untouched
+	assert.Empty(t, call(current))
+	assert.Zero(t, deprecatedCount(t, current))
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDraining is reported by the Drainer's readiness check once draining has begun
+var ErrDraining = errors.New("server is draining")
+
+// Drainer tracks whether the server is shutting down.  Once Drain
+// has been called, its middleware responds to new requests with
+// 503 Service Unavailable so that load balancers stop routing to
+// this instance, while requests already in flight complete normally.
+type Drainer struct {
+	draining   atomic.Bool
+	retryAfter time.Duration
+	hooks      []DrainHook
+}
+
+// DrainHook annotates the headers of a response written while draining,
+// whether a 503 rejecting a new request or the response to a request
+// which was in flight when Drain was called
+type DrainHook func(h http.Header, r *http.Request)
+
+// CloseConnection is a DrainHook which asks HTTP/1.1 clients to close
+// the connection once the response has been received.
+//
+// http.Server.Shutdown closes keep-alive connections only once they are
+// idle, so a client whose request was in flight may otherwise reuse its
+// connection, racing the close, and see an error rather than reconnect
+// to another instance.  With "Connection: close", the server closes the
+// connection after the response and the client reconnects at once.
+// HTTP/2 has no Connection header; there, Shutdown's GOAWAY serves.
+func CloseConnection(h http.Header, r *http.Request) {
+	h.Set("Connection", "close")
+}
+
+// NewDrainer returns a Drainer which advises clients to retry after the given duration
+func NewDrainer(retryAfter time.Duration) *Drainer {
+	return &Drainer{retryAfter: retryAfter}
+}
+
+// Drain marks the server as draining
+func (d *Drainer) Drain() {
+	d.draining.Store(true)
+}
+
+// IsDraining reports whether Drain has been called
+func (d *Drainer) IsDraining() bool {
+	return d.draining.Load()
+}
+
+// OnDrain registers hooks, run in order, which annotate the responses
+// written while draining.  Hooks must be registered before the Drainer's
+// middleware begins serving.
+func (d *Drainer) OnDrain(hooks ...DrainHook) {
+	d.hooks = append(d.hooks, hooks...)
+}
+
+func (d *Drainer) runHooks(h http.Header, r *http.Request) {
+	for _, hook := range d.hooks {
+		hook(h, r)
+	}
+}
+
+// Handler returns middleware which rejects new requests while draining
+// and runs the OnDrain hooks on the responses written while draining
+func (d *Drainer) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.IsDraining() {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", strconv.Itoa(int(d.retryAfter.Seconds())))
+			d.runHooks(w.Header(), r)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if len(d.hooks) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// the request is in flight; if draining begins before its
+		// response headers are sent, they are annotated
+		hw := NewHTTPWriter(w)
+		hw.onWriteHeader(func(header http.Header) {
+			if d.IsDraining() {
+				d.runHooks(header, r)
+			}
+		})
+
+		h.ServeHTTP(hw, r)
+		hw.runHeaderHooks() // for a response with neither headers nor body written
+	})
+}
+
+// ReadinessCheck returns a check which fails once draining has begun.  It
+// is suitable for registration as a healthcheck.CheckWithContext.
+func (d *Drainer) ReadinessCheck() func(context.Context) error {
+	return func(context.Context) error {
+		if d.IsDraining() {
+			return ErrDraining
+		}
+		return nil
+	}
+}
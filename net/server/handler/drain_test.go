@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainHooks(t *testing.T) {
+	drainer := NewDrainer(time.Second)
+	drainer.OnDrain(CloseConnection, func(h http.Header, r *http.Request) {
+		h.Set("X-Draining", r.URL.Path)
+	})
+
+	inFlight := make(chan struct{})
+	proceed := make(chan struct{})
+	h := drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(inFlight)
+			<-proceed
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	// not draining: responses are untouched
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Connection"))
+	assert.Empty(t, rr.Header().Get("X-Draining"))
+
+	// draining begins while a request is in flight: it completes,
+	// with its response annotated
+	slow := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(slow, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-inFlight
+	drainer.Drain()
+	close(proceed)
+	<-done
+
+	assert.Equal(t, http.StatusOK, slow.Code)
+	assert.Equal(t, "ok", slow.Body.String())
+	assert.Equal(t, "close", slow.Header().Get("Connection"))
+	assert.Equal(t, "/slow", slow.Header().Get("X-Draining"))
+
+	// new requests are rejected, with the hooks' annotations
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/new", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "/new", rr.Header().Get("X-Draining"))
+}
+
+func TestDrainHooksWithoutBody(t *testing.T) {
+	drainer := NewDrainer(time.Second)
+	drainer.OnDrain(CloseConnection)
+
+	h := drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drainer.Drain() // draining begins before anything is written
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "close", rr.Header().Get("Connection"))
+}
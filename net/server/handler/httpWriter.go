@@ -21,6 +21,7 @@
 package handler
 
 import (
+	"bytes"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -33,6 +34,11 @@ type HTTPWriter struct {
 	statusCode    int
 	contentLength int
 	logger        *zap.Logger
+	headerHooks   []func(http.Header)
+	headerWritten bool
+	body          *bytes.Buffer
+	bodyLimit     int
+	bodyTruncated bool
 }
 
 // HTTPWriterOption permits customization of an HTTPWriter
@@ -44,6 +50,15 @@ func EnableLogging(logger *zap.Logger) HTTPWriterOption {
 	return func(w *HTTPWriter) { w.logger = logger }
 }
 
+// CaptureBody copies up to limit bytes of the response body, as it is
+// written, to buf (see BodyTruncated)
+func CaptureBody(buf *bytes.Buffer, limit int) HTTPWriterOption {
+	return func(w *HTTPWriter) {
+		w.body = buf
+		w.bodyLimit = limit
+	}
+}
+
 func NewHTTPWriter(w http.ResponseWriter, options ...HTTPWriterOption) *HTTPWriter {
 	writer := &HTTPWriter{w: w}
 
@@ -66,15 +81,66 @@ func (l *HTTPWriter) Write(data []byte) (int, error) {
 			zap.Int("len", len(data)))
 	}
 
+	l.runHeaderHooks()
 	l.contentLength += len(data)
+	if l.body != nil && !l.bodyTruncated {
+		if l.body.Len()+len(data) > l.bodyLimit {
+			l.bodyTruncated = true
+		} else {
+			l.body.Write(data)
+		}
+	}
 	return l.w.Write(data)
 }
 
 func (l *HTTPWriter) WriteHeader(status int) {
+	l.runHeaderHooks()
 	l.statusCode = status
 	l.w.WriteHeader(status)
 }
 
+// Flush sends any buffered data to the client, if the underlying
+// ResponseWriter supports it, so that streaming handlers, e.g., the
+// hystrix event stream, work through the access logger
+func (l *HTTPWriter) Flush() {
+	l.runHeaderHooks()
+	if l.statusCode == 0 {
+		l.statusCode = http.StatusOK // flushing commits the headers
+	}
+
+	if f, ok := l.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController
+func (l *HTTPWriter) Unwrap() http.ResponseWriter {
+	return l.w
+}
+
+// onWriteHeader registers a func to be called with the response
+// headers immediately before they are sent to the client
+func (l *HTTPWriter) onWriteHeader(fn func(http.Header)) {
+	l.headerHooks = append(l.headerHooks, fn)
+}
+
+func (l *HTTPWriter) runHeaderHooks() {
+	if l.headerWritten {
+		return
+	}
+	l.headerWritten = true
+
+	for _, fn := range l.headerHooks {
+		fn(l.w.Header())
+	}
+}
+
+// BodyTruncated reports whether the response body exceeded the limit
+// given to CaptureBody, in which case the captured copy is incomplete
+func (l *HTTPWriter) BodyTruncated() bool {
+	return l.bodyTruncated
+}
+
 func (l *HTTPWriter) Length() int {
 	return l.contentLength
 }
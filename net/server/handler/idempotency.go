@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mchudgins/go/net/server/correlationID"
+	"github.com/mchudgins/go/net/server/user"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client's idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayHeader is set to "true" on a response replayed from the store
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	// MaxIdempotentBody is the largest response body saved for replay,
+	// and the largest request body accepted with an Idempotency-Key
+	MaxIdempotentBody = 1 << 20
+
+	// memorySweepInterval is how often a MemoryIdempotencyStore discards
+	// its expired responses
+	memorySweepInterval = time.Minute
+)
+
+// CachedResponse is a response saved by the Idempotency middleware
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// RequestHash is the SHA-256 of the body of the request which
+	// produced the response
+	RequestHash [sha256.Size]byte
+}
+
+// IdempotencyStore saves responses for replay by the Idempotency middleware
+type IdempotencyStore interface {
+	// Get returns the response saved for key, if it has not expired
+	Get(key string) (*CachedResponse, bool)
+
+	// Set saves the response for key until ttl has elapsed
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// Idempotency returns middleware which replays the saved response to a
+// request carrying an Idempotency-Key header seen within ttl, rather
+// than processing it again.  Keys are scoped to the caller -- the user
+// in the request context, e.g., from ClientCertUser, or else the subject
+// of the verified client certificate -- and to the request's method and
+// path.  A request with the header but no such caller is rejected with
+// 401 Unauthorized, so that one client cannot replay another's response.
+// A duplicate arriving while the original is still in progress receives
+// 409 Conflict, and one whose body differs from the original's receives
+// 422 Unprocessable Entity, as does a body larger than MaxIdempotentBody.  Server errors (5xx), and bodies larger than
+// MaxIdempotentBody, are not saved, so the client may retry them, and
+// Set-Cookie is never replayed.  Requests without the header are
+// processed normally.
+func Idempotency(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	inFlight := make(map[string]bool)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+			if len(idempotencyKey) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			principal := idempotencyPrincipal(r)
+			if len(principal) == 0 {
+				http.Error(w, "an authenticated caller is required to use an Idempotency-Key", http.StatusUnauthorized)
+				return
+			}
+			key := strconv.Quote(principal) + " " + r.Method + " " + r.URL.Path + " " + idempotencyKey
+
+			// the body is read up front, so that a retry may be compared
+			// with the original before the handler sees it
+			requestBody, err := io.ReadAll(io.LimitReader(r.Body, MaxIdempotentBody+1))
+			if err != nil {
+				http.Error(w, "unable to read the request body", http.StatusBadRequest)
+				return
+			}
+			if len(requestBody) > MaxIdempotentBody {
+				http.Error(w, "the request body is too large to use an Idempotency-Key", http.StatusUnprocessableEntity)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+			requestHash := sha256.Sum256(requestBody)
+
+			mu.Lock()
+			if cached, ok := store.Get(key); ok {
+				mu.Unlock()
+				if cached.RequestHash != requestHash {
+					http.Error(w, "the Idempotency-Key was used with a different request body", http.StatusUnprocessableEntity)
+					return
+				}
+				replay(w, cached)
+				return
+			}
+			if inFlight[key] {
+				mu.Unlock()
+				http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+				return
+			}
+			inFlight[key] = true
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(inFlight, key)
+				mu.Unlock()
+			}()
+
+			body := &bytes.Buffer{}
+			lw := NewHTTPWriter(w, CaptureBody(body, MaxIdempotentBody))
+			h.ServeHTTP(lw, r)
+
+			status := lw.StatusCode()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status < http.StatusInternalServerError && !lw.BodyTruncated() {
+				header := lw.Header().Clone()
+				header.Del("Set-Cookie")
+
+				store.Set(key, &CachedResponse{
+					StatusCode:  status,
+					Header:      header,
+					Body:        body.Bytes(),
+					RequestHash: requestHash,
+				}, ttl)
+			}
+		})
+	}
+}
+
+// idempotencyPrincipal identifies the caller to whom an idempotency key
+// belongs, or returns "" if the caller is unauthenticated
+func idempotencyPrincipal(r *http.Request) string {
+	if id := user.FromContext(r.Context()); len(id) > 0 {
+		return id
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.String()
+	}
+
+	return ""
+}
+
+func replay(w http.ResponseWriter, cached *CachedResponse) {
+	for name, values := range cached.Header {
+		if name == correlationID.CORRID {
+			continue // the replay has its own correlation ID
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayHeader, "true")
+	w.WriteHeader(cached.StatusCode)
+	_, _ = w.Write(cached.Body)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore for a single instance
+// of a service.  An expired response is discarded when it is next
+// requested, and the rest, at most once a minute, as new ones are saved.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]memoryEntry
+	nextSweep time.Time
+}
+
+type memoryEntry struct {
+	resp    *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		responses: make(map[string]memoryEntry),
+		nextSweep: time.Now().Add(memorySweepInterval),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.responses[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.responses, key)
+		return nil, false
+	}
+
+	return entry.resp, true
+}
+
+func (s *MemoryIdempotencyStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextSweep) {
+		for k, entry := range s.responses {
+			if now.After(entry.expires) {
+				delete(s.responses, k)
+			}
+		}
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+
+	s.responses[key] = memoryEntry{resp: resp, expires: now.Add(ttl)}
+}
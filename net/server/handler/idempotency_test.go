@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mchudgins/go/net/server/user"
+)
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	calls := 0
+	h := Idempotency(NewMemoryIdempotencyStore(), time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("order " + strconv.Itoa(calls)))
+	}))
+
+	post := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		r = r.WithContext(user.NewContext(r.Context(), "alice"))
+		if len(key) > 0 {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	first := post("abc")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "order 1", first.Body.String())
+	assert.Empty(t, first.Header().Get(IdempotentReplayHeader))
+
+	replayed := post("abc")
+	assert.Equal(t, http.StatusCreated, replayed.Code)
+	assert.Equal(t, "order 1", replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotentReplayHeader))
+
+	assert.Equal(t, "order 2", post("def").Body.String())
+	assert.Equal(t, "order 3", post("").Body.String())
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotencyIsScopedToTheCaller(t *testing.T) {
+	calls := 0
+	h := Idempotency(NewMemoryIdempotencyStore(), time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(calls)})
+		_, _ = w.Write([]byte("order " + strconv.Itoa(calls)))
+	}))
+
+	post := func(r *http.Request) *httptest.ResponseRecorder {
+		r.Header.Set(IdempotencyKeyHeader, "abc")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+	as := func(id string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		return r.WithContext(user.NewContext(r.Context(), id))
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post(httptest.NewRequest(http.MethodPost, "/orders", nil)).Code)
+	assert.Equal(t, 0, calls)
+
+	first := post(as("alice"))
+	assert.Equal(t, "order 1", first.Body.String())
+	assert.NotEmpty(t, first.Header().Get("Set-Cookie"))
+
+	// another caller reusing the key is not given alice's response
+	assert.Equal(t, "order 2", post(as("mallory")).Body.String())
+
+	replayed := post(as("alice"))
+	assert.Equal(t, "order 1", replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotentReplayHeader))
+	assert.Empty(t, replayed.Header().Get("Set-Cookie"))
+
+	// a verified client certificate identifies its holder
+	r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "client"}}}}}
+	assert.Equal(t, "order 3", post(r).Body.String())
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotencyDoesNotSaveLargeBodies(t *testing.T) {
+	calls := 0
+	h := Idempotency(NewMemoryIdempotencyStore(), time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write(bytes.Repeat([]byte("x"), MaxIdempotentBody))
+		_, _ = w.Write([]byte("!"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/exports", nil)
+		r = r.WithContext(user.NewContext(r.Context(), "alice"))
+		r.Header.Set(IdempotencyKeyHeader, "abc")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		assert.Equal(t, MaxIdempotentBody+1, rr.Body.Len())
+	}
+	assert.Equal(t, 2, calls, "a body larger than MaxIdempotentBody is not replayed")
+}
+
+func TestIdempotencyRejectsADifferentBody(t *testing.T) {
+	calls := 0
+	h := Idempotency(NewMemoryIdempotencyStore(), time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		r = r.WithContext(user.NewContext(r.Context(), "alice"))
+		r.Header.Set(IdempotencyKeyHeader, "abc")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// the handler still sees the body
+	assert.Equal(t, `{"amount":10}`, post(`{"amount":10}`).Body.String())
+
+	replayed := post(`{"amount":10}`)
+	assert.Equal(t, `{"amount":10}`, replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotentReplayHeader))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, post(`{"amount":1000}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, post(strings.Repeat("x", MaxIdempotentBody+1)).Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMemoryIdempotencyStoreExpires(t *testing.T) {
+	s := NewMemoryIdempotencyStore()
+	s.Set("expired", &CachedResponse{}, -time.Second)
+	s.Set("stale", &CachedResponse{}, -time.Second)
+	s.Set("live", &CachedResponse{}, time.Minute)
+
+	// an expired response is discarded when requested
+	_, ok := s.Get("expired")
+	assert.False(t, ok)
+	_, ok = s.Get("live")
+	assert.True(t, ok)
+	assert.Len(t, s.responses, 2)
+
+	// and the rest, by the next sweep
+	s.nextSweep = time.Now().Add(-time.Second)
+	s.Set("new", &CachedResponse{}, time.Minute)
+	assert.Len(t, s.responses, 2)
+	_, ok = s.responses["stale"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PrettyQueryParam is the query parameter a client may set ("?pretty=1")
+// to request indented JSON
+const PrettyQueryParam = "pretty"
+
+// EncodeJSON writes v to w as JSON.  Output is compact unless pretty is
+// true or the request asks for indentation via ?pretty=1.  The
+// Content-Type is set to application/json if the caller has not already
+// set one; as with any header, it must be set before the status code is
+// written to take effect.
+func EncodeJSON(w http.ResponseWriter, r *http.Request, v interface{}, pretty bool) error {
+	if len(w.Header().Get("Content-Type")) == 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	if !pretty && r != nil {
+		pretty = r.URL.Query().Get(PrettyQueryParam) == "1"
+	}
+
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", "    ")
+	}
+
+	return encoder.Encode(v)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// the content types EncodeMessage can produce
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeText     = "text/plain"
+)
+
+// messageSerializers are offered by EncodeMessage in order of preference,
+// so that a client which accepts anything, e.g., a browser, receives JSON
+var messageSerializers = NewSerializers().
+	Register(ContentTypeJSON+"; charset=utf-8", ProtoJSONEncoder).
+	Register(ContentTypeProtobuf, ProtobufEncoder).
+	Register(ContentTypeText+"; charset=utf-8", ProtoTextEncoder)
+
+// ErrNotAcceptable is returned by EncodeMessage & Serializers.Encode when
+// the client accepts none of the content types they can produce
+var ErrNotAcceptable = errors.New("no acceptable content type")
+
+// NegotiateContentType returns the offer the client most prefers, according
+// to the q-values of its Accept header.  Ties go to the earliest offer, as
+// does a request without an Accept header.  ok is false if the client
+// accepts none of offers.
+func NegotiateContentType(r *http.Request, offers ...string) (contentType string, ok bool) {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		if len(offers) == 0 {
+			return "", false
+		}
+		return offers[0], true
+	}
+
+	best := 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > best {
+			contentType, best = offer, q
+		}
+	}
+
+	return contentType, best > 0
+}
+
+// acceptQuality returns the q-value of the most specific media range in
+// accept which matches offer
+func acceptQuality(accept []string, offer string) float64 {
+	offerType, offerSubtype, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, value := range accept {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+
+			rangeType, rangeSubtype, _ := strings.Cut(mediaType, "/")
+			var s int
+			switch {
+			case rangeType == offerType && rangeSubtype == offerSubtype:
+				s = 2
+			case rangeType == offerType && rangeSubtype == "*":
+				s = 1
+			case rangeType == "*" && rangeSubtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1.0
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+
+	return q
+}
+
+// EncodeMessage writes msg to w in the representation the client prefers:
+// JSON (indented via ?pretty=1), the protobuf wire format or the protobuf
+// text format.  If the client accepts none of these, it responds with 406
+// Not Acceptable and returns ErrNotAcceptable.
+func EncodeMessage(w http.ResponseWriter, r *http.Request, msg proto.Message) error {
+	return messageSerializers.Encode(w, r, http.StatusOK, msg)
+}
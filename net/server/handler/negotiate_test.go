@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestEncodeMessage(t *testing.T) {
+	msg := durationpb.New(90 * time.Second)
+	wire, err := proto.Marshal(msg)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		accept      string
+		expect      int
+		contentType string
+		body        string
+	}{
+		{name: "no Accept header", expect: http.StatusOK, contentType: ContentTypeJSON, body: `"90s"`},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8",
+			expect: http.StatusOK, contentType: ContentTypeJSON, body: `"90s"`},
+		{name: "protobuf", accept: ContentTypeProtobuf, expect: http.StatusOK, contentType: ContentTypeProtobuf, body: string(wire)},
+		{name: "q-values", accept: "application/json;q=0.5, application/x-protobuf",
+			expect: http.StatusOK, contentType: ContentTypeProtobuf, body: string(wire)},
+		{name: "text", accept: "text/*", expect: http.StatusOK, contentType: ContentTypeText},
+		{name: "refused", accept: "application/json;q=0, */*", expect: http.StatusOK, contentType: ContentTypeProtobuf},
+		{name: "not acceptable", accept: "image/png", expect: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			err := EncodeMessage(rr, r, msg)
+			assert.Equal(t, tt.expect, rr.Code)
+			if tt.expect == http.StatusNotAcceptable {
+				assert.ErrorIs(t, err, ErrNotAcceptable)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Contains(t, rr.Header().Get("Content-Type"), tt.contentType)
+			if len(tt.body) > 0 {
+				assert.Equal(t, tt.body, rr.Body.String())
+			}
+		})
+	}
+}
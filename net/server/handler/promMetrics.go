@@ -24,8 +24,8 @@ package handler
 import (
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -61,6 +61,13 @@ var (
 		},
 		[]string{"url"},
 	)
+	httpRequestsByUserAgent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_by_user_agent_total",
+			Help: "Number of HTTP requests received, by category of User-Agent.",
+		},
+		[]string{"category"},
+	)
 
 	connMapMutex sync.Mutex
 	connMap      = make(map[string]func())
@@ -87,13 +94,82 @@ func init() {
 	prometheus.MustRegister(httpRequestsProcessed)
 	prometheus.MustRegister(httpRequestDuration)
 	prometheus.MustRegister(httpResponseSize)
+	prometheus.MustRegister(httpRequestsByUserAgent)
 	prometheus.MustRegister(connNew)
 	prometheus.MustRegister(connActive)
 	prometheus.MustRegister(connIdle)
 	prometheus.MustRegister(connClosed)
 }
 
+// UserAgentOther is the category of User-Agents matching no UserAgentCategory
+const UserAgentOther = "other"
+
+// UserAgentCategory labels the requests whose User-Agent matches Pattern
+type UserAgentCategory struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultUserAgentCategories are the categories used by WithUserAgentMetrics
+// when none are provided
+var DefaultUserAgentCategories = []UserAgentCategory{
+	{Name: "grpc", Pattern: regexp.MustCompile(`^grpc-`)},
+	{Name: "curl", Pattern: regexp.MustCompile(`^curl/`)},
+	{Name: "bot", Pattern: regexp.MustCompile(`(?i)bot|crawler|spider`)},
+	{Name: "browser", Pattern: regexp.MustCompile(`^Mozilla/`)},
+}
+
+// userAgentCategory returns the name of the first category matching
+// userAgent, or UserAgentOther
+func userAgentCategory(categories []UserAgentCategory, userAgent string) string {
+	for _, c := range categories {
+		if c.Pattern.MatchString(userAgent) {
+			return c.Name
+		}
+	}
+
+	return UserAgentOther
+}
+
+type metricsConfig struct {
+	userAgents []UserAgentCategory
+}
+
+// MetricsOption customizes the collector returned by NewHTTPMetricsCollector
+type MetricsOption func(*metricsConfig)
+
+// WithUserAgentMetrics counts requests in http_requests_by_user_agent_total,
+// labelled with the name of the first of categories matching the request's
+// User-Agent, or UserAgentOther.  Since the label's values are limited to
+// the categories' names, its cardinality is bounded.  If no categories are
+// provided, DefaultUserAgentCategories are used.
+func WithUserAgentMetrics(categories ...UserAgentCategory) MetricsOption {
+	return func(cfg *metricsConfig) {
+		if len(categories) == 0 {
+			categories = DefaultUserAgentCategories
+		}
+		cfg.userAgents = categories
+	}
+}
+
+// HTTPMetricsCollector records the prometheus request metrics
 func HTTPMetricsCollector(fn http.Handler) http.Handler {
+	return NewHTTPMetricsCollector()(fn)
+}
+
+// NewHTTPMetricsCollector returns an HTTPMetricsCollector customized by options
+func NewHTTPMetricsCollector(options ...MetricsOption) func(http.Handler) http.Handler {
+	cfg := &metricsConfig{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(fn http.Handler) http.Handler {
+		return cfg.collector(fn)
+	}
+}
+
+func (cfg *metricsConfig) collector(fn http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -102,6 +178,12 @@ func HTTPMetricsCollector(fn http.Handler) http.Handler {
 			"url": u,
 		}).Inc()
 
+		if len(cfg.userAgents) > 0 {
+			httpRequestsByUserAgent.With(prometheus.Labels{
+				"category": userAgentCategory(cfg.userAgents, r.UserAgent()),
+			}).Inc()
+		}
+
 		// we want the status code from the handler chain,
 		// so inject an HTTPWriter, if one doesn't exist
 
@@ -130,11 +212,21 @@ func HTTPMetricsCollector(fn http.Handler) http.Handler {
 	})
 }
 
+// listenPort returns the port of addr, for both IPv4 & IPv6 (bracketed)
+// addresses, or the whole address if it has no port, e.g., a unix socket
+func listenPort(addr net.Addr) string {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return port
+}
+
 // HTTPConnectionMetricsCollector generates prometheus metrics for connection state
 // see:  https://golang.org/pkg/net/http/#ConnState
 func HTTPConnectionMetricsCollector(c net.Conn, newState http.ConnState) {
-	addr := c.LocalAddr().String()
-	port := addr[strings.LastIndex(addr, ":")+1:]
+	port := listenPort(c.LocalAddr())
 	remoteAddr := c.RemoteAddr().String()
 
 	//fmt.Printf("HTTPConnectionMetricsCollector: remoteAddr %s; port %s; newState %s\n", remoteAddr, port, newState.String())
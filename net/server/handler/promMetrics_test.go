@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestListenPort(t *testing.T) {
+	assert.Equal(t, "8080", listenPort(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8080}))
+	assert.Equal(t, "8080", listenPort(&net.TCPAddr{IP: net.IPv6loopback, Port: 8080}))
+	assert.Equal(t, "8443", listenPort(&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 8443, Zone: "eth0"}))
+	assert.Equal(t, "/run/app.sock", listenPort(&net.UnixAddr{Name: "/run/app.sock", Net: "unix"}))
+}
+
+func TestHTTPConnectionMetricsCollectorIPv6(t *testing.T) {
+	c := addrConn{
+		local:  &net.TCPAddr{IP: net.IPv6loopback, Port: 18080},
+		remote: &net.TCPAddr{IP: net.IPv6loopback, Port: 51000},
+	}
+
+	HTTPConnectionMetricsCollector(c, http.StateNew)
+	defer HTTPConnectionMetricsCollector(c, http.StateClosed)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	var ports []string
+	for _, family := range families {
+		if family.GetName() != "http_conn_new" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetGauge().GetValue() > 0 {
+				ports = append(ports, m.GetLabel()[0].GetValue())
+			}
+		}
+	}
+	assert.Equal(t, []string{"18080"}, ports)
+}
+
+func userAgentCount(t *testing.T, category string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "http_requests_by_user_agent_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() == category {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestUserAgentMetrics(t *testing.T) {
+	assert.Equal(t, "grpc", userAgentCategory(DefaultUserAgentCategories, "grpc-go/1.64.0"))
+	assert.Equal(t, "curl", userAgentCategory(DefaultUserAgentCategories, "curl/8.5.0"))
+	assert.Equal(t, "bot", userAgentCategory(DefaultUserAgentCategories, "Mozilla/5.0 (compatible; Googlebot/2.1)"))
+	assert.Equal(t, "browser", userAgentCategory(DefaultUserAgentCategories, "Mozilla/5.0 (X11; Linux x86_64)"))
+	assert.Equal(t, UserAgentOther, userAgentCategory(DefaultUserAgentCategories, "Go-http-client/1.1"))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(h http.Handler, userAgent string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", userAgent)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// off by default
+	request(HTTPMetricsCollector(ok), "wget/1.21")
+	assert.Zero(t, userAgentCount(t, "wget"))
+	assert.Zero(t, userAgentCount(t, UserAgentOther))
+
+	h := NewHTTPMetricsCollector(WithUserAgentMetrics(UserAgentCategory{Name: "wget", Pattern: regexp.MustCompile(`^[Ww]get/`)}))(ok)
+	request(h, "wget/1.21")
+	request(h, "Wget/1.20")
+	request(h, "some-client/0.1")
+	assert.Equal(t, float64(2), userAgentCount(t, "wget"))
+	assert.Equal(t, float64(1), userAgentCount(t, UserAgentOther))
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestRecord summarizes a completed request
+type RequestRecord struct {
+	Time          time.Time     `json:"time"`
+	Method        string        `json:"method"` // the HTTP method, or "gRPC"
+	Path          string        `json:"path"`   // the URL path, or the full gRPC method name
+	Status        int           `json:"status"` // the HTTP status, or the gRPC status code
+	Duration      time.Duration `json:"duration"`
+	CorrelationID string        `json:"correlationID"`
+}
+
+// RequestRecorder keeps the most recent requests in a fixed-size ring
+// buffer, for on-box debugging.  It is fed by the access loggers (see
+// WithRequestRecorder) and serves the requests, newest first, as HTML or
+// as JSON to clients which accept application/json.
+type RequestRecorder struct {
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+	full    bool
+	handler http.Handler
+}
+
+// NewRequestRecorder returns a RequestRecorder holding the last n requests
+func NewRequestRecorder(n int) *RequestRecorder {
+	if n < 1 {
+		n = 1
+	}
+
+	rr := &RequestRecorder{records: make([]RequestRecord, n)}
+	rr.handler = NoStore()(http.HandlerFunc(rr.serve))
+
+	return rr
+}
+
+// Record adds rec, displacing the oldest record if the buffer is full
+func (rr *RequestRecorder) Record(rec RequestRecord) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	rr.records[rr.next] = rec
+	rr.next = (rr.next + 1) % len(rr.records)
+	if rr.next == 0 {
+		rr.full = true
+	}
+}
+
+// Recent returns the recorded requests, newest first
+func (rr *RequestRecorder) Recent() []RequestRecord {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	n := rr.next
+	if rr.full {
+		n = len(rr.records)
+	}
+
+	recent := make([]RequestRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, rr.records[(rr.next-i+len(rr.records))%len(rr.records)])
+	}
+
+	return recent
+}
+
+var requestsTemplate = template.Must(template.New("requests").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Recent Requests</title></head>
+<body>
+<h1>Recent Requests</h1>
+<table>
+<tr><th>Time</th><th>Method</th><th>Path</th><th>Status</th><th>Duration</th><th>Correlation ID</th></tr>
+{{range .}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Status}}</td><td>{{.Duration}}</td><td>{{.CorrelationID}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// requestSerializers offer HTML, for a browser, ahead of JSON
+var requestSerializers = NewSerializers().
+	Register("text/html; charset=utf-8", func(w io.Writer, r *http.Request, v interface{}) error {
+		return requestsTemplate.Execute(w, v)
+	}).
+	Register(ContentTypeJSON+"; charset=utf-8", JSONEncoder)
+
+func (rr *RequestRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rr.handler.ServeHTTP(w, r)
+}
+
+func (rr *RequestRecorder) serve(w http.ResponseWriter, r *http.Request) {
+	if err := requestSerializers.Encode(w, r, http.StatusOK, rr.Recent()); err != nil && err != ErrNotAcceptable {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	rec := NewRequestRecorder(2)
+	h := HTTPAccessLogger(zap.NewNop(), WithRequestRecorder(rec), WithSampling(0))(http.NotFoundHandler())
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+strconv.Itoa(i)+"?secret=1", nil))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/debug/requests", nil)
+	r.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	rec.ServeHTTP(rr, r)
+
+	var recent []RequestRecord
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &recent))
+	if assert.Len(t, recent, 2, "only the last 2 requests should be kept") {
+		assert.Equal(t, "/2", recent[0].Path, "newest first, without the query")
+		assert.Equal(t, "/1", recent[1].Path)
+		assert.Equal(t, http.StatusNotFound, recent[0].Status)
+		assert.NotEmpty(t, recent[0].CorrelationID)
+	}
+
+	rr = httptest.NewRecorder()
+	rec.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/requests", nil))
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	assert.Contains(t, rr.Body.String(), "<td>/2</td>")
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// RedirectOrReject is how RequireHTTPS treats a plaintext request
+type RedirectOrReject int
+
+const (
+	// RedirectToHTTPS redirects plaintext requests to their https URL
+	RedirectToHTTPS RedirectOrReject = iota
+	// RejectPlaintext responds to plaintext requests with 403 Forbidden
+	RejectPlaintext
+)
+
+// ForwardedProtoHeader is set by a TLS-terminating proxy to the scheme of
+// the client's request
+const ForwardedProtoHeader = "X-Forwarded-Proto"
+
+type httpsConfig struct {
+	trusted []netip.Prefix
+	host    string
+}
+
+// HTTPSOption customizes RequireHTTPS
+type HTTPSOption func(*httpsConfig)
+
+// WithTrustedProxies trusts the X-Forwarded-Proto header of requests
+// arriving from the given addresses or CIDR ranges, e.g., "10.0.0.0/8",
+// which is otherwise ignored, since any client can set it.  It panics if
+// one of proxies is invalid (see ParseTrustedProxies).
+func WithTrustedProxies(proxies ...string) HTTPSOption {
+	prefixes, err := ParseTrustedProxies(proxies...)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return func(cfg *httpsConfig) {
+		cfg.trusted = append(cfg.trusted, prefixes...)
+	}
+}
+
+// WithHTTPSHost redirects to host, rather than the request's Host, so that
+// a redirect to a canonical host and to https takes a single hop
+func WithHTTPSHost(host string) HTTPSOption {
+	if u, err := url.Parse(host); err == nil && len(u.Host) > 0 {
+		host = u.Host // e.g., "https://www.example.com"
+	}
+
+	return func(cfg *httpsConfig) { cfg.host = host }
+}
+
+// ParseTrustedProxies parses addresses, e.g., "10.1.2.3", or CIDR ranges,
+// e.g., "10.0.0.0/8", as for WithTrustedProxies
+func ParseTrustedProxies(proxies ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// RequireHTTPS returns middleware which allows only requests made over
+// TLS: either to this server directly, or to a trusted proxy, as reported
+// by its X-Forwarded-Proto header (see WithTrustedProxies).  Plaintext
+// requests are either rejected with 403 Forbidden or redirected to https,
+// with 301 Moved Permanently for GET & HEAD and 308 Permanent Redirect
+// otherwise, so that the method & body are preserved.
+func RequireHTTPS(mode RedirectOrReject, options ...HTTPSOption) func(http.Handler) http.Handler {
+	cfg := &httpsConfig{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.isHTTPS(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if mode == RejectPlaintext {
+				http.Error(w, "HTTPS is required", http.StatusForbidden)
+				return
+			}
+
+			host := cfg.host
+			if len(host) == 0 {
+				host = r.Host
+			}
+			target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+
+			code := http.StatusMovedPermanently
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				code = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, r, target.String(), code)
+		})
+	}
+}
+
+// isHTTPS reports whether r arrived over TLS
+func (cfg *httpsConfig) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	values := r.Header.Values(ForwardedProtoHeader)
+	if len(values) == 0 || !cfg.isTrusted(r.RemoteAddr) {
+		return false
+	}
+
+	// a proxy appends to what it received, which the client controls,
+	// so only the last value, set by the nearest proxy, is trusted
+	proto := values[len(values)-1]
+	if i := strings.LastIndexByte(proto, ','); i >= 0 {
+		proto = proto[i+1:]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+func (cfg *httpsConfig) isTrusted(remoteAddr string) bool {
+	return trustedPeer(cfg.trusted, remoteAddr)
+}
+
+// trustedPeer reports whether remoteAddr, e.g., a request's RemoteAddr,
+// is within one of trusted
+func trustedPeer(trusted []netip.Prefix, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
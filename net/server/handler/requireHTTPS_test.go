@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRequireHTTPS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		mode     RedirectOrReject
+		method   string
+		remote   string
+		tls      bool
+		proto    string
+		expect   int
+		location string
+	}{
+		{name: "direct TLS", tls: true, expect: http.StatusOK},
+		{name: "plaintext redirected", expect: http.StatusMovedPermanently, location: "https://api.example.com/a%2Fb?q=1"},
+		{name: "plaintext POST keeps its method", method: http.MethodPost, expect: http.StatusPermanentRedirect, location: "https://api.example.com/a%2Fb?q=1"},
+		{name: "plaintext rejected", mode: RejectPlaintext, expect: http.StatusForbidden},
+		{name: "trusted proxy, https", remote: "10.1.2.3:4567", proto: "https", expect: http.StatusOK},
+		{name: "trusted proxy chain", remote: "[::ffff:10.1.2.3]:4567", proto: "http, HTTPS", expect: http.StatusOK},
+		{name: "client-supplied https appended to", mode: RejectPlaintext, remote: "10.1.2.3:4567", proto: "https, http", expect: http.StatusForbidden},
+		{name: "trusted proxy, http", mode: RejectPlaintext, remote: "10.1.2.3:4567", proto: "http", expect: http.StatusForbidden},
+		{name: "untrusted header ignored", mode: RejectPlaintext, remote: "192.0.2.1:4567", proto: "https", expect: http.StatusForbidden},
+	}
+
+	h := RequireHTTPS(RedirectToHTTPS, WithTrustedProxies("10.0.0.0/8"))(ok)
+	reject := RequireHTTPS(RejectPlaintext, WithTrustedProxies("10.0.0.0/8"))(ok)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if len(method) == 0 {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://api.example.com/a%2Fb?q=1", nil)
+			if len(tt.remote) > 0 {
+				r.RemoteAddr = tt.remote
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if len(tt.proto) > 0 {
+				r.Header.Set(ForwardedProtoHeader, tt.proto)
+			}
+
+			rr := httptest.NewRecorder()
+			if tt.mode == RejectPlaintext {
+				reject.ServeHTTP(rr, r)
+			} else {
+				h.ServeHTTP(rr, r)
+			}
+			assert.Equal(t, tt.expect, rr.Code)
+			assert.Equal(t, tt.location, rr.Header().Get("Location"))
+		})
+	}
+
+	// the proxy may append its own header rather than extend the client's
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	r.Header.Add(ForwardedProtoHeader, "https")
+	r.Header.Add(ForwardedProtoHeader, "http")
+	rr := httptest.NewRecorder()
+	reject.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	assert.Panics(t, func() { WithTrustedProxies("not-an-address") })
+}
+
+func TestRequireHTTPSWithCanonicalHost(t *testing.T) {
+	h := DefaultChain(zap.NewNop(),
+		WithCanonicalHost("https://www.example.com"),
+		WithRequireHTTPS(RedirectToHTTPS),
+	).ThenFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// plaintext at another host: a single hop to https at the canonical host
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/path", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "https://www.example.com/path"))
+
+	r := httptest.NewRequest(http.MethodGet, "https://www.example.com/path", nil)
+	r.TLS = &tls.ConnectionState{}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
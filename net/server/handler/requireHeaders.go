@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// HeaderRequirement describes a request header which must be present
+// for a request to be handled
+type HeaderRequirement struct {
+	Name    string         // the header name, e.g., Accept-Version
+	Pattern *regexp.Regexp // if non-nil, the header value must match
+	Vary    bool           // if true, the response varies by this header
+}
+
+type headerError struct {
+	Error  string `json:"error"`
+	Header string `json:"header"`
+}
+
+// RequireHeaders returns middleware which rejects, with 400 Bad Request,
+// any request that is missing one of the required headers or whose
+// value does not match the requirement's Pattern.
+func RequireHeaders(specs ...HeaderRequirement) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, spec := range specs {
+				if spec.Vary {
+					AddVary(w.Header(), spec.Name)
+				}
+
+				value := r.Header.Get(spec.Name)
+				if len(value) == 0 {
+					writeHeaderError(w, r, "missing required header", spec.Name)
+					return
+				}
+
+				if spec.Pattern != nil && !spec.Pattern.MatchString(value) {
+					writeHeaderError(w, r, "invalid header value", spec.Name)
+					return
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeHeaderError(w http.ResponseWriter, r *http.Request, msg, name string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = EncodeJSON(w, r, headerError{Error: msg, Header: name}, false)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	h := RequireHeaders(
+		HeaderRequirement{Name: "Accept-Version", Pattern: regexp.MustCompile(`^v[0-9]+$`), Vary: true},
+		HeaderRequirement{Name: "X-Tenant-ID"},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		expect  int
+		body    string
+	}{
+		{name: "missing", headers: map[string]string{"Accept-Version": "v2"}, expect: http.StatusBadRequest,
+			body: `{"error":"missing required header","header":"X-Tenant-ID"}`},
+		{name: "invalid", headers: map[string]string{"Accept-Version": "latest", "X-Tenant-ID": "acme"}, expect: http.StatusBadRequest,
+			body: `{"error":"invalid header value","header":"Accept-Version"}`},
+		{name: "valid", headers: map[string]string{"Accept-Version": "v2", "X-Tenant-ID": "acme"}, expect: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.expect, rr.Code)
+			if len(tt.body) > 0 {
+				assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+				assert.JSONEq(t, tt.body, rr.Body.String())
+			}
+
+			// only the header marked Vary is listed, whatever the outcome
+			assert.Equal(t, []string{"Accept-Version"}, rr.Header().Values("Vary"))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encoder writes v in the representation of the content type for which
+// it is registered, e.g., YAML or CBOR
+type Encoder func(w io.Writer, r *http.Request, v interface{}) error
+
+// Serializers is a registry of Encoders, by content type, from which a
+// handler responds in the representation the client prefers:
+//
+//	s := NewSerializers().
+//		Register("application/json; charset=utf-8", JSONEncoder).
+//		Register("application/yaml", yamlEncoder)
+//	err := s.Encode(w, r, http.StatusOK, v)
+type Serializers struct {
+	offers   []string // media types, in order of preference
+	types    map[string]string
+	encoders map[string]Encoder
+}
+
+// NewSerializers returns an empty registry
+func NewSerializers() *Serializers {
+	return &Serializers{
+		types:    make(map[string]string),
+		encoders: make(map[string]Encoder),
+	}
+}
+
+// Register adds, or replaces, the encoder of contentType, which may carry
+// parameters, e.g., "text/plain; charset=utf-8", to be sent in the
+// Content-Type header.  When the client has no preference, the content
+// types registered first are preferred.  It returns s, for chaining.
+func (s *Serializers) Register(contentType string, enc Encoder) *Serializers {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		panic(fmt.Sprintf("invalid content type %q -- %s", contentType, err))
+	}
+
+	if _, ok := s.encoders[mediaType]; !ok {
+		s.offers = append(s.offers, mediaType)
+	}
+	s.types[mediaType] = contentType
+	s.encoders[mediaType] = enc
+
+	return s
+}
+
+// ContentTypes returns the media types registered, in order of preference
+func (s *Serializers) ContentTypes() []string {
+	return append([]string(nil), s.offers...)
+}
+
+// Encode writes v, with the given status, in the representation the
+// client prefers, adding Accept to the Vary header.  If the client accepts
+// none of the registered content types, it responds with 406 Not
+// Acceptable and returns ErrNotAcceptable.  If the encoder fails, nothing
+// is written, so that the caller may respond with an error.
+func (s *Serializers) Encode(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	AddVary(w.Header(), "Accept")
+
+	mediaType, ok := NegotiateContentType(r, s.offers...)
+	if !ok {
+		http.Error(w, ErrNotAcceptable.Error()+"; try one of "+strings.Join(s.offers, ", "),
+			http.StatusNotAcceptable)
+		return ErrNotAcceptable
+	}
+
+	var body bytes.Buffer
+	if err := s.encoders[mediaType](&body, r, v); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", s.types[mediaType])
+	w.WriteHeader(status)
+	_, err := w.Write(body.Bytes())
+
+	return err
+}
+
+// JSONEncoder encodes v as JSON, indented if requested via ?pretty=1
+func JSONEncoder(w io.Writer, r *http.Request, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	if r != nil && r.URL.Query().Get(PrettyQueryParam) == "1" {
+		encoder.SetIndent("", "    ")
+	}
+
+	return encoder.Encode(v)
+}
+
+// ProtoJSONEncoder encodes a proto.Message as JSON, indented if requested
+// via ?pretty=1
+func ProtoJSONEncoder(w io.Writer, r *http.Request, v interface{}) error {
+	msg, err := protoMessage(v)
+	if err != nil {
+		return err
+	}
+
+	options := protojson.MarshalOptions{}
+	if r != nil && r.URL.Query().Get(PrettyQueryParam) == "1" {
+		options.Indent = "    "
+	}
+
+	return writeMarshaled(w)(options.Marshal(msg))
+}
+
+// ProtobufEncoder encodes a proto.Message in the protobuf wire format
+func ProtobufEncoder(w io.Writer, r *http.Request, v interface{}) error {
+	msg, err := protoMessage(v)
+	if err != nil {
+		return err
+	}
+
+	return writeMarshaled(w)(proto.Marshal(msg))
+}
+
+// ProtoTextEncoder encodes a proto.Message in the protobuf text format
+func ProtoTextEncoder(w io.Writer, r *http.Request, v interface{}) error {
+	msg, err := protoMessage(v)
+	if err != nil {
+		return err
+	}
+
+	return writeMarshaled(w)(prototext.MarshalOptions{Multiline: true}.Marshal(msg))
+}
+
+func protoMessage(v interface{}) (proto.Message, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+
+	return msg, nil
+}
+
+// writeMarshaled writes the output of a Marshal func to w
+func writeMarshaled(w io.Writer) func([]byte, error) error {
+	return func(b []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializers(t *testing.T) {
+	yaml := func(w io.Writer, r *http.Request, v interface{}) error {
+		_, err := fmt.Fprintf(w, "name: %s\n", v.(map[string]string)["name"])
+		return err
+	}
+	s := NewSerializers().
+		Register(ContentTypeJSON+"; charset=utf-8", JSONEncoder).
+		Register("application/yaml", yaml)
+	assert.Equal(t, []string{ContentTypeJSON, "application/yaml"}, s.ContentTypes())
+
+	v := map[string]string{"name": "widget"}
+	tests := []struct {
+		name        string
+		accept      string
+		expect      int
+		contentType string
+		body        string
+	}{
+		{name: "no preference", expect: http.StatusCreated, contentType: "application/json; charset=utf-8", body: "{\"name\":\"widget\"}\n"},
+		{name: "yaml", accept: "application/yaml", expect: http.StatusCreated, contentType: "application/yaml", body: "name: widget\n"},
+		{name: "q-values", accept: "application/json;q=0.5, application/*", expect: http.StatusCreated, contentType: "application/yaml"},
+		{name: "not acceptable", accept: "application/cbor", expect: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			err := s.Encode(rr, r, http.StatusCreated, v)
+			assert.Equal(t, tt.expect, rr.Code)
+			assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+			if tt.expect == http.StatusNotAcceptable {
+				assert.ErrorIs(t, err, ErrNotAcceptable)
+				assert.Contains(t, rr.Body.String(), "application/json, application/yaml")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			if len(tt.body) > 0 {
+				assert.Equal(t, tt.body, rr.Body.String())
+			}
+		})
+	}
+
+	// re-registering replaces the encoder, keeping its place
+	s.Register(ContentTypeJSON, func(w io.Writer, r *http.Request, v interface{}) error {
+		return errors.New("encoding failed")
+	})
+	assert.Equal(t, []string{ContentTypeJSON, "application/yaml"}, s.ContentTypes())
+
+	// a failed encoding writes nothing, so the caller can respond
+	rr := httptest.NewRecorder()
+	assert.EqualError(t, s.Encode(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, v), "encoding failed")
+	assert.False(t, rr.Flushed)
+	assert.Empty(t, rr.Header().Get("Content-Type"))
+	assert.Zero(t, rr.Body.Len())
+
+	assert.Panics(t, func() { NewSerializers().Register("not a content type", JSONEncoder) })
+}
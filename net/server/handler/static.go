@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticETag caches a file's entity tag, which is recomputed only if the
+// file's size or modification time changes
+type staticETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// StaticFS returns a handler which serves the files of fsys, e.g., an
+// embed.FS, for request paths beginning with prefix.  Responses carry the
+// file's Content-Type, an ETag (a content hash, since embedded files have
+// no modification time) and, if the file has one, Last-Modified, so that
+// conditional requests are answered with 304 Not Modified.  Unless the
+// handler is wrapped with other cache middleware, e.g., CachePublic,
+// Cache-Control is "no-cache", meaning clients revalidate before reuse.
+// A request for a directory serves its index.html; directories are
+// never listed.
+func StaticFS(fsys fs.FS, prefix string) http.Handler {
+	var etags sync.Map // file name -> staticETag
+
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if len(name) == 0 {
+			name = "."
+		}
+
+		name, f, info, err := openStatic(fsys, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		// files of an embed.FS, or an os.DirFS, can be served as they are;
+		// those of other file systems are read into memory
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			b, err := io.ReadAll(f)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			content = bytes.NewReader(b)
+		}
+
+		cached, ok := etags.Load(name)
+		if tag, _ := cached.(staticETag); !ok || tag.size != info.Size() || !tag.modTime.Equal(info.ModTime()) {
+			hash := sha256.New()
+			if _, err := io.Copy(hash, content); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if _, err := content.Seek(0, io.SeekStart); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			cached = staticETag{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				etag:    `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16]) + `"`,
+			}
+			etags.Store(name, cached)
+		}
+
+		w.Header().Set("ETag", cached.(staticETag).etag)
+		if len(w.Header().Get("Cache-Control")) == 0 {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+	}))
+}
+
+// openStatic opens the named file, or the index.html of the named
+// directory, returning the name of the file opened
+func openStatic(fsys fs.FS, name string) (string, fs.File, fs.FileInfo, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return name, nil, nil, err
+	}
+
+	if info.IsDir() {
+		name = path.Join(name, "index.html")
+		if info, err = fs.Stat(fsys, name); err != nil {
+			return name, nil, nil, err
+		}
+		if info.IsDir() {
+			return name, nil, nil, fs.ErrNotExist
+		}
+	}
+
+	f, err := fsys.Open(name)
+	return name, f, info, err
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestStaticFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>")},
+		"css/style.css": {Data: []byte("body {}")},
+	}
+	h := HTTPAccessLogger(zap.NewNop())(StaticFS(fsys, "/static"))
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(etag) > 0 {
+			r.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := get("/static/css/style.css", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/css; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+	assert.Equal(t, "body {}", rr.Body.String())
+
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, get("/static/css/style.css", etag).Code)
+
+	// a changed file is served with a new ETag
+	fsys["css/style.css"] = &fstest.MapFile{Data: []byte("body { color: red }")}
+	rr = get("/static/css/style.css", etag)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "body { color: red }", rr.Body.String())
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+
+	rr = get("/static/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "<html></html>", rr.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("/static/css/", "").Code, "directories should not be listed")
+	assert.Equal(t, http.StatusNotFound, get("/static/missing.js", "").Code)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ContentTypeJSONLines is the content type of a stream of JSON values,
+// one per line
+const ContentTypeJSONLines = "application/x-ndjson"
+
+// jsonLinesFlushInterval bounds how long an item written by StreamJSONLines
+// may sit in the response buffer
+const jsonLinesFlushInterval = 100 * time.Millisecond
+
+// StreamJSONLines writes each item received from items to w as a line of
+// JSON, until items is closed, so that a large result need not be held in
+// memory.  Output is flushed to the client periodically.  If the client
+// disconnects, StreamJSONLines returns the request context's error; the
+// producer should watch the same context & stop sending.
+func StreamJSONLines(w http.ResponseWriter, r *http.Request, items <-chan interface{}) error {
+	w.Header().Set("Content-Type", ContentTypeJSONLines)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	ticker := time.NewTicker(jsonLinesFlushInterval)
+	defer ticker.Stop()
+
+	encoder := json.NewEncoder(w) // Encode terminates each value with a newline
+	pending := false
+	for {
+		select {
+		case <-r.Context().Done():
+			return r.Context().Err()
+
+		case <-ticker.C:
+			if pending {
+				flush()
+				pending = false
+			}
+
+		case item, ok := <-items:
+			if !ok {
+				flush()
+				return nil
+			}
+
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+			pending = true
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TeeBody reads up to max bytes of the request body, e.g., for logging, and
+// returns them, replacing r.Body with a reader which yields the same bytes
+// followed by the unread remainder, so the handler still sees the whole
+// body.  Only max bytes are buffered, however large the body.
+func TeeBody(r *http.Request, max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody || max <= 0 {
+		return nil, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, max))
+	r.Body = &teeBody{
+		Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+		closer: r.Body,
+	}
+
+	return buf, err
+}
+
+type teeBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *teeBody) Close() error {
+	return b.closer.Close()
+}
+
+// WithRequestBodies logs up to max bytes of the bodies of requests for
+// the given paths; a path ending in "/" matches every path beneath it.
+// Bodies may contain credentials or personal data, so this is intended
+// for specific debug endpoints, not wholesale use.
+func WithRequestBodies(max int64, paths ...string) AccessLogOption {
+	return func(cfg *accessLogConfig) {
+		cfg.bodyMax = max
+		cfg.bodyPaths = append(cfg.bodyPaths, paths...)
+	}
+}
+
+// logBody reports whether the body of a request for path is logged
+func (cfg *accessLogConfig) logBody(path string) bool {
+	for _, p := range cfg.bodyPaths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/metadata"
+)
+
+// the W3C Trace Context headers (https://www.w3.org/TR/trace-context/)
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// parseTraceparent returns the trace & parent span IDs of a W3C
+// traceparent header, e.g.,
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", and whether
+// the header is well-formed
+func parseTraceparent(traceparent string) (traceID, spanID string, sampled bool, ok bool) {
+	traceparent = strings.TrimSpace(traceparent)
+
+	// version-traceID-spanID-flags; later versions may append fields
+	if len(traceparent) < 55 || (len(traceparent) > 55 && traceparent[55] != '-') {
+		return "", "", false, false
+	}
+	version, traceID, spanID, flags := traceparent[0:2], traceparent[3:35], traceparent[36:52], traceparent[53:55]
+	if traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return "", "", false, false
+	}
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(traceparent) != 55) {
+		return "", "", false, false
+	}
+	if !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		!isLowerHex(spanID) || spanID == strings.Repeat("0", 16) ||
+		!isLowerHex(flags) {
+		return "", "", false, false
+	}
+
+	// the sampled flag is the low bit of the flags' value
+	bits, err := strconv.ParseUint(flags, 16, 8)
+	if err != nil {
+		return "", "", false, false
+	}
+
+	return traceID, spanID, bits&1 == 1, true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceContextFields returns the fields logged for the trace context of
+// a request, which join the access log with the traces produced
+// upstream, or nil if traceparent is absent or malformed
+func traceContextFields(traceparent, tracestate string) []zapcore.Field {
+	traceID, spanID, sampled, ok := parseTraceparent(traceparent)
+	if !ok {
+		return nil
+	}
+
+	fields := []zapcore.Field{
+		zap.String("traceID", traceID),
+		zap.String("spanID", spanID),
+		zap.Bool("traceSampled", sampled),
+	}
+	if tracestate = strings.TrimSpace(tracestate); len(tracestate) > 0 {
+		fields = append(fields, zap.String("traceState", tracestate))
+	}
+
+	return fields
+}
+
+// httpTraceContextFields returns the trace context fields of an HTTP request
+func httpTraceContextFields(h http.Header) []zapcore.Field {
+	traceparent := h.Values(TraceparentHeader)
+	if len(traceparent) != 1 { // a repeated traceparent is malformed
+		return nil
+	}
+
+	// a repeated tracestate is the concatenation of its values
+	return traceContextFields(traceparent[0], strings.Join(h.Values(TracestateHeader), ","))
+}
+
+// rpcTraceContextFields returns the trace context fields of an RPC
+func rpcTraceContextFields(md metadata.MD) []zapcore.Field {
+	traceparent := md.Get(TraceparentHeader)
+	if len(traceparent) != 1 {
+		return nil
+	}
+
+	return traceContextFields(traceparent[0], strings.Join(md.Get(TracestateHeader), ","))
+}
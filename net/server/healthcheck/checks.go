@@ -26,13 +26,19 @@ import (
 	"runtime"
 )
 
+// GoroutineCount returns the number of goroutines currently running, e.g.,
+// for diagnostics when tuning the threshold of a GoroutineCountCheck
+func GoroutineCount() int {
+	return runtime.NumGoroutine()
+}
+
 // GoroutineCountCheck returns a Check that fails if too many goroutines are
 // running (which could indicate a resource leak).
 func GoroutineCountCheck(threshold int) CheckWithContext {
 	return func(ctx context.Context) error {
-		count := runtime.NumGoroutine()
+		count := GoroutineCount()
 		if count > threshold {
-			return fmt.Errorf("too many goroutines (%d > %d)", count, threshold)
+			return fmt.Errorf("goroutine count %d exceeds threshold %d", count, threshold)
 		}
 		return nil
 	}
@@ -22,6 +22,9 @@ package healthcheck
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,5 +33,33 @@ import (
 func TestGoroutineCountCheck(t *testing.T) {
 	ctx := context.Background()
 	assert.NoError(t, GoroutineCountCheck(1000)(ctx))
-	assert.Error(t, GoroutineCountCheck(0)(ctx))
+
+	err := GoroutineCountCheck(0)(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeds threshold 0")
+	}
+	assert.Greater(t, GoroutineCount(), 0)
+}
+
+func TestDownstreamCheck(t *testing.T) {
+	var probes atomic.Int32
+	status := int32(http.StatusOK)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, DownstreamCheck("up", ts.Client(), ts.URL+"/healthz/ready")(ctx))
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	check := DownstreamCheck("down", ts.Client(), ts.URL+"/healthz/ready")
+	for i := 0; i < 5; i++ {
+		err := check(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, "downstream down returned 503", err.Error())
+		}
+	}
+	assert.Equal(t, int32(2), probes.Load(), "results should be cached")
 }
@@ -0,0 +1,128 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// DefaultDownstreamTTL is how long a downstream check caches its result,
+	// so that frequent probes of this service don't become a storm of
+	// probes of its downstreams
+	DefaultDownstreamTTL = 5 * time.Second
+
+	// DefaultDownstreamTimeout bounds each probe of a downstream
+	DefaultDownstreamTimeout = 2 * time.Second
+)
+
+// Cached returns a Check which runs check at most once per ttl, returning
+// the cached result in between.  Concurrent callers share a single run.
+func Cached(check CheckWithContext, ttl time.Duration) CheckWithContext {
+	var (
+		mu      sync.Mutex
+		expires time.Time
+		result  error
+	)
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Now().Before(expires) {
+			return result
+		}
+
+		result = check(ctx)
+		expires = time.Now().Add(ttl)
+
+		return result
+	}
+}
+
+// DownstreamCheck returns a Check which fails unless a GET of target,
+// a downstream service's health endpoint, e.g.,
+// "http://accounts:8080/healthz/ready", returns a 2xx status.  Results
+// are cached for DefaultDownstreamTTL; name identifies the downstream in
+// the error.
+func DownstreamCheck(name string, client *http.Client, target string) CheckWithContext {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return Cached(func(ctx context.Context) error {
+		ctx, cancel := downstreamContext(ctx)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return fmt.Errorf("downstream %s: %w", name, err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("downstream %s: %w", name, err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // permit connection reuse
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("downstream %s returned %d", name, resp.StatusCode)
+		}
+
+		return nil
+	}, DefaultDownstreamTTL)
+}
+
+// RPCDownstreamCheck returns a Check which fails unless client, using the
+// gRPC health protocol, reports service as SERVING.  An empty service
+// asks after the server as a whole.  Results are cached for
+// DefaultDownstreamTTL; name identifies the downstream in the error.
+func RPCDownstreamCheck(name string, client healthgrpc.HealthClient, service string) CheckWithContext {
+	return Cached(func(ctx context.Context) error {
+		ctx, cancel := downstreamContext(ctx)
+		defer cancel()
+
+		resp, err := client.Check(ctx, &healthgrpc.HealthCheckRequest{Service: service})
+		if err != nil {
+			return fmt.Errorf("downstream %s: %w", name, err)
+		}
+
+		if resp.GetStatus() != healthgrpc.HealthCheckResponse_SERVING {
+			return fmt.Errorf("downstream %s is %s", name, resp.GetStatus())
+		}
+
+		return nil
+	}, DefaultDownstreamTTL)
+}
+
+// downstreamContext detaches a probe from the cancellation of the request
+// which triggered it, since its result is shared with other requests
+func downstreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), DefaultDownstreamTimeout)
+}
@@ -22,50 +22,153 @@ package healthcheck
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	eccolog "github.com/mchudgins/go/log"
+	gsh "github.com/mchudgins/go/net/server/handler"
+	"github.com/mchudgins/go/version"
+)
+
+const (
+	statusOK     = "OK"
+	statusFailed = "FAILED"
 )
 
+// DefaultLivePath, DefaultReadyPath and DefaultStartupPath are where
+// NewHandler serves its endpoints.  Each is also served without the
+// "/healthz" prefix, for handlers mounted under a prefix which is stripped.
+const (
+	DefaultLivePath    = "/healthz/live"
+	DefaultReadyPath   = "/healthz/ready"
+	DefaultStartupPath = "/healthz/startup"
+)
+
+// CheckResult is the outcome of a single check, as reported in the
+// full (?full=1) response.
+type CheckResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"durationMs"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// Report is the body of the full (?full=1) response.
+type Report struct {
+	Version string                 `json:"version"`
+	Status  string                 `json:"status"`
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
 // handlerWithContext is a handler implementation supporting context.Context.
 type handlerWithContext struct {
 	checksMutex     sync.RWMutex
 	livenessChecks  map[string]CheckWithContext
 	readinessChecks map[string]CheckWithContext
+	startupChecks   map[string]CheckWithContext
+
+	// lastStatus holds the most recent result of each check, keyed by
+	// check type and name, so that transitions can be reported
+	statusMutex sync.Mutex
+	lastStatus  map[checkKey]bool
+
+	mux *http.ServeMux
 }
 
+type checkKey struct {
+	checkType string
+	name      string
+}
+
+// NewHandler returns a Handler serving the liveness, readiness and startup
+// endpoints at their default paths, with or without the "/healthz" prefix.
 func NewHandler() Handler {
+	return newHandler(
+		[]string{DefaultLivePath, strings.TrimPrefix(DefaultLivePath, "/healthz")},
+		[]string{DefaultReadyPath, strings.TrimPrefix(DefaultReadyPath, "/healthz")},
+	)
+}
+
+// NewHandlerWithPaths returns a Handler serving the liveness & readiness
+// endpoints at exactly the given paths, e.g., "/livez" and "/readyz".  The
+// startup endpoint stays at its default paths.  It panics if either path
+// does not begin with a '/', ends with a '/' (which a ServeMux would treat
+// as a subtree rather than an exact match), or if the paths are the same.
+func NewHandlerWithPaths(live, ready string) Handler {
+	for _, p := range []string{live, ready} {
+		if !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") || strings.ContainsAny(p, " \t{}") {
+			panic(fmt.Sprintf("healthcheck: invalid endpoint path %q", p))
+		}
+	}
+	if live == ready {
+		panic(fmt.Sprintf("healthcheck: liveness & readiness share the path %q", live))
+	}
+
+	return newHandler([]string{live}, []string{ready})
+}
+
+func newHandler(live, ready []string) *handlerWithContext {
 	h := &handlerWithContext{
 		livenessChecks:  make(map[string]CheckWithContext),
 		readinessChecks: make(map[string]CheckWithContext),
+		startupChecks:   make(map[string]CheckWithContext),
+		lastStatus:      make(map[checkKey]bool),
+		mux:             http.NewServeMux(),
+	}
+
+	startup := []string{DefaultStartupPath, strings.TrimPrefix(DefaultStartupPath, "/healthz")}
+	for _, route := range []struct {
+		paths   []string
+		handler http.HandlerFunc
+	}{
+		{live, h.LiveEndpoint},
+		{ready, h.ReadyEndpoint},
+		{startup, h.StartupEndpoint},
+	} {
+		for _, p := range route.paths {
+			// a custom path may take one of the default startup paths
+			if h.handles(p) {
+				continue
+			}
+			h.mux.Handle(p, route.handler)
+		}
 	}
 
+	endpoints := strings.Join([]string{live[0], ready[0], startup[0]}, ", ")
+	h.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprintf(w, "valid health check endpoints are %s\n", endpoints)
+	})
+
 	return h
 }
 
-func (s *handlerWithContext) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if strings.HasSuffix(r.URL.Path, "/live") {
-		s.LiveEndpoint(w, r)
-		return
-	}
-
-	if strings.HasSuffix(r.URL.Path, "/ready") {
-		s.ReadyEndpoint(w, r)
-		return
-	}
+// handles reports whether the path has been registered already
+func (s *handlerWithContext) handles(path string) bool {
+	_, pattern := s.mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}})
+	return pattern == path
+}
 
-	w.WriteHeader(http.StatusNotFound)
-	_, _ = fmt.Fprintf(w, "valid health check endpoints are /healthz/live and /healthz/ready\n")
+func (s *handlerWithContext) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
 }
 
 func (s *handlerWithContext) LiveEndpoint(w http.ResponseWriter, r *http.Request) {
-	s.handle(w, r, s.livenessChecks)
+	s.handle(w, r, livenessType)
 }
 
 func (s *handlerWithContext) ReadyEndpoint(w http.ResponseWriter, r *http.Request) {
-	s.handle(w, r, s.readinessChecks, s.livenessChecks)
+	s.handle(w, r, readinessType, livenessType, startupType)
+}
+
+func (s *handlerWithContext) StartupEndpoint(w http.ResponseWriter, r *http.Request) {
+	s.handle(w, r, startupType)
 }
 
 func (s *handlerWithContext) AddLivenessCheck(name string, check CheckWithContext) {
@@ -80,29 +183,98 @@ func (s *handlerWithContext) AddReadinessCheck(name string, check CheckWithConte
 	s.readinessChecks[name] = check
 }
 
-func (s *handlerWithContext) collectChecks(ctx context.Context, checks map[string]CheckWithContext, resultsOut map[string]string, statusOut *int) {
+func (s *handlerWithContext) AddStartupCheck(name string, check CheckWithContext) {
+	s.checksMutex.Lock()
+	defer s.checksMutex.Unlock()
+	s.startupChecks[name] = check
+}
+
+func (s *handlerWithContext) SetReadyAfter(d time.Duration) *Warmup {
+	w := NewWarmup(d)
+	s.AddStartupCheck("warmup", w.Check())
+
+	return w
+}
+
+func (s *handlerWithContext) collectChecks(ctx context.Context, checkType string, resultsOut map[string]CheckResult, statusOut *int) {
 	s.checksMutex.RLock()
 	defer s.checksMutex.RUnlock()
+
+	checks := s.livenessChecks
+	switch checkType {
+	case readinessType:
+		checks = s.readinessChecks
+	case startupType:
+		checks = s.startupChecks
+	}
+
 	for name, check := range checks {
-		if err := check(ctx); err != nil {
+		start := time.Now()
+		err := check(ctx)
+
+		result := CheckResult{
+			Status:     statusOK,
+			DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+			CheckedAt:  start.UTC(),
+		}
+		if err != nil {
 			*statusOut = http.StatusServiceUnavailable
-			resultsOut[name] = err.Error()
-		} else {
-			resultsOut[name] = "OK"
+			result.Status = statusFailed
+			result.Error = err.Error()
 		}
+		resultsOut[name] = result
+
+		s.recordStatus(ctx, checkType, name, err)
 	}
 }
 
-func (s *handlerWithContext) handle(w http.ResponseWriter, r *http.Request, checks ...map[string]CheckWithContext) {
+// recordStatus updates the status metric for a check and, if the check
+// has changed between OK and failing since it last ran, logs the
+// transition and counts it as a flap.
+func (s *handlerWithContext) recordStatus(ctx context.Context, checkType, name string, err error) {
+	ok := err == nil
+	if ok {
+		checkStatus.WithLabelValues(name, checkType).Set(1)
+	} else {
+		checkStatus.WithLabelValues(name, checkType).Set(0)
+	}
+
+	key := checkKey{checkType: checkType, name: name}
+
+	s.statusMutex.Lock()
+	previous, seen := s.lastStatus[key]
+	s.lastStatus[key] = ok
+	s.statusMutex.Unlock()
+
+	if !seen || previous == ok {
+		return
+	}
+
+	checkFlaps.WithLabelValues(name, checkType).Inc()
+
+	logger := eccolog.FromContext(ctx)
+	if ok {
+		logger.Info("health check recovered",
+			zap.String("check", name),
+			zap.String("type", checkType))
+	} else {
+		logger.Warn("health check failing",
+			zap.String("check", name),
+			zap.String("type", checkType),
+			zap.Error(err))
+	}
+}
+
+func (s *handlerWithContext) handle(w http.ResponseWriter, r *http.Request, checkTypes ...string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	checkResults := make(map[string]string)
+	checkResults := make(map[string]CheckResult)
 	status := http.StatusOK
-	for _, check := range checks {
-		s.collectChecks(r.Context(), check, checkResults, &status)
+	for _, checkType := range checkTypes {
+		s.collectChecks(r.Context(), checkType, checkResults, &status)
 	}
 
 	// write out the response code and content type header
@@ -116,9 +288,16 @@ func (s *handlerWithContext) handle(w http.ResponseWriter, r *http.Request, chec
 		return
 	}
 
+	report := Report{
+		Version: version.VERSION,
+		Status:  statusOK,
+		Checks:  checkResults,
+	}
+	if status != http.StatusOK {
+		report.Status = statusFailed
+	}
+
 	// otherwise, write the JSON body ignoring any encoding errors (which
-	// shouldn't really be possible since we're encoding a map[string]string).
-	encoder := json.NewEncoder(w)
-	encoder.SetIndent("", "    ")
-	_ = encoder.Encode(checkResults)
+	// shouldn't really be possible since the report is plain data).
+	_ = gsh.EncodeJSON(w, r, report, false)
 }
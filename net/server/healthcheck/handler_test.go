@@ -22,12 +22,16 @@ package healthcheck
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mchudgins/go/version"
 )
 
 func TestNewHandler(t *testing.T) {
@@ -39,6 +43,9 @@ func TestNewHandler(t *testing.T) {
 		ready      bool
 		expect     int
 		expectBody string
+		// expectChecks, if set, maps each check expected in the full
+		// report to its expected error
+		expectChecks map[string]string
 	}{
 		{
 			name:   "GET /foo should generate a 404",
@@ -83,40 +90,40 @@ func TestNewHandler(t *testing.T) {
 			expectBody: "{}\n",
 		},
 		{
-			name:       "with a failing readiness check, /live should still succeed",
-			method:     "GET",
-			path:       "/live?full=1",
-			live:       true,
-			ready:      false,
-			expect:     http.StatusOK,
-			expectBody: "{}\n",
+			name:         "with a failing readiness check, /live should still succeed",
+			method:       "GET",
+			path:         "/live?full=1",
+			live:         true,
+			ready:        false,
+			expect:       http.StatusOK,
+			expectChecks: map[string]string{},
 		},
 		{
-			name:       "with a failing readiness check, /ready should fail",
-			method:     "GET",
-			path:       "/ready?full=1",
-			live:       true,
-			ready:      false,
-			expect:     http.StatusServiceUnavailable,
-			expectBody: "{\n    \"test-readiness-check\": \"failed readiness check\"\n}\n",
+			name:         "with a failing readiness check, /ready should fail",
+			method:       "GET",
+			path:         "/ready?full=1",
+			live:         true,
+			ready:        false,
+			expect:       http.StatusServiceUnavailable,
+			expectChecks: map[string]string{"test-readiness-check": "failed readiness check"},
 		},
 		{
-			name:       "with a failing liveness check, /live should fail",
-			method:     "GET",
-			path:       "/live?full=1",
-			live:       false,
-			ready:      true,
-			expect:     http.StatusServiceUnavailable,
-			expectBody: "{\n    \"test-liveness-check\": \"failed liveness check\"\n}\n",
+			name:         "with a failing liveness check, /live should fail",
+			method:       "GET",
+			path:         "/live?full=1",
+			live:         false,
+			ready:        true,
+			expect:       http.StatusServiceUnavailable,
+			expectChecks: map[string]string{"test-liveness-check": "failed liveness check"},
 		},
 		{
-			name:       "with a failing liveness check, /ready should fail",
-			method:     "GET",
-			path:       "/ready?full=1",
-			live:       false,
-			ready:      true,
-			expect:     http.StatusServiceUnavailable,
-			expectBody: "{\n    \"test-liveness-check\": \"failed liveness check\"\n}\n",
+			name:         "with a failing liveness check, /ready should fail",
+			method:       "GET",
+			path:         "/ready?full=1",
+			live:         false,
+			ready:        true,
+			expect:       http.StatusServiceUnavailable,
+			expectChecks: map[string]string{"test-liveness-check": "failed liveness check"},
 		},
 		{
 			name:       "with a failing liveness check, /ready without full=1 should fail with an empty body",
@@ -155,6 +162,88 @@ func TestNewHandler(t *testing.T) {
 			if tt.expectBody != "" {
 				assert.Equal(t, tt.expectBody, rr.Body.String(), "wrong body for %q", reqStr)
 			}
+
+			if tt.expectChecks != nil {
+				var report Report
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report), "invalid body for %q", reqStr)
+				assert.Equal(t, version.VERSION, report.Version)
+				if tt.expect == http.StatusOK {
+					assert.Equal(t, statusOK, report.Status)
+				} else {
+					assert.Equal(t, statusFailed, report.Status)
+				}
+
+				errs := make(map[string]string)
+				for name, result := range report.Checks {
+					errs[name] = result.Error
+					assert.False(t, result.CheckedAt.IsZero(), "missing checkedAt for %q", name)
+				}
+				assert.Equal(t, tt.expectChecks, errs, "wrong checks for %q", reqStr)
+			}
 		})
 	}
 }
+
+func TestSetReadyAfter(t *testing.T) {
+	status := func(h Handler, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	// ready once warmup is done, ahead of the deadline
+	h := NewHandler()
+	warmup := h.SetReadyAfter(time.Hour)
+	assert.Equal(t, http.StatusOK, status(h, "/live"))
+	assert.Equal(t, http.StatusServiceUnavailable, status(h, "/startup"))
+	assert.Equal(t, http.StatusServiceUnavailable, status(h, "/ready"))
+
+	warmup.Done()
+	warmup.Done()
+	assert.Equal(t, http.StatusOK, status(h, "/startup"))
+	assert.Equal(t, http.StatusOK, status(h, "/ready"))
+
+	// or once the deadline passes, without Done
+	h = NewHandler()
+	h.SetReadyAfter(20 * time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, status(h, "/ready"))
+	assert.Eventually(t, func() bool {
+		return status(h, "/ready") == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+
+	// with no deadline, only Done completes the warmup
+	w := NewWarmup(0)
+	assert.ErrorIs(t, w.Check()(context.Background()), ErrWarmingUp)
+	w.Done()
+	assert.NoError(t, w.Check()(context.Background()))
+}
+
+func TestHandlerPaths(t *testing.T) {
+	status := func(h Handler, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	h := NewHandler()
+	h.AddReadinessCheck("down", func(context.Context) error { return errors.New("down") })
+	for _, path := range []string{"/live", "/healthz/live", "/startup", "/healthz/startup"} {
+		assert.Equal(t, http.StatusOK, status(h, path), path)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, status(h, "/healthz/ready"))
+	for _, path := range []string{"/foo/live", "/healthz/live/", "/healthz/lively", "/"} {
+		assert.Equal(t, http.StatusNotFound, status(h, path), path)
+	}
+
+	h = NewHandlerWithPaths("/livez", "/readyz")
+	h.AddReadinessCheck("down", func(context.Context) error { return errors.New("down") })
+	assert.Equal(t, http.StatusOK, status(h, "/livez"))
+	assert.Equal(t, http.StatusServiceUnavailable, status(h, "/readyz"))
+	assert.Equal(t, http.StatusOK, status(h, "/healthz/startup"))
+	assert.Equal(t, http.StatusNotFound, status(h, "/healthz/live"))
+	assert.Equal(t, http.StatusNotFound, status(h, "/ready"))
+
+	assert.Panics(t, func() { NewHandlerWithPaths("livez", "/readyz") })
+	assert.Panics(t, func() { NewHandlerWithPaths("/healthz/", "/readyz") })
+	assert.Panics(t, func() { NewHandlerWithPaths("/healthz", "/healthz") })
+}
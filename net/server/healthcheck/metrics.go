@@ -0,0 +1,61 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package healthcheck
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	livenessType  = "liveness"
+	readinessType = "readiness"
+	startupType   = "startup"
+)
+
+var (
+	checkStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "healthcheck_status",
+			Help: "Result of the most recent run of a health check (1 = OK, 0 = failing).",
+		},
+		[]string{"check", "type"},
+	)
+	checkFlaps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "healthcheck_flaps_total",
+			Help: "Number of times a health check has changed between OK and failing.",
+		},
+		[]string{"check", "type"},
+	)
+	goroutines = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "healthcheck_goroutines",
+			Help: "Number of goroutines currently running, as seen by GoroutineCountCheck.",
+		},
+		func() float64 { return float64(GoroutineCount()) },
+	)
+)
+
+func init() {
+	prometheus.MustRegister(checkStatus)
+	prometheus.MustRegister(checkFlaps)
+	prometheus.MustRegister(goroutines)
+}
@@ -23,17 +23,18 @@ package healthcheck
 import (
 	"context"
 	"net/http"
+	"time"
 )
 
 // Check is a health/readiness check which takes a context.
 type CheckWithContext func(context.Context) error
 
 // Handler is an http.Handler with additional methods that register health and
-// readiness checks. It handles handle "/live" and "/ready" HTTP
-// endpoints.
+// readiness checks. It handles the "/healthz/live", "/healthz/ready" and
+// "/healthz/startup" HTTP endpoints, or those given to NewHandlerWithPaths.
 type Handler interface {
 	// The Handler is an http.Handler, so it can be exposed directly and handle
-	// /live and /ready endpoints.
+	// the liveness, readiness & startup endpoints.  Paths match exactly.
 	http.Handler
 
 	// AddLivenessCheck adds a check that indicates that this instance of the
@@ -49,6 +50,17 @@ type Handler interface {
 	// destroyed.
 	AddReadinessCheck(name string, check CheckWithContext)
 
+	// AddStartupCheck adds a check that indicates that this instance of the
+	// application has not yet finished starting, e.g., warming its caches.
+	// Every startup check is also included as a readiness check, so a cold
+	// instance receives no requests.  Its endpoint, /startup, suits a
+	// Kubernetes startupProbe.
+	AddStartupCheck(name string, check CheckWithContext)
+
+	// SetReadyAfter adds a startup check, "warmup", which fails until the
+	// returned Warmup's Done is called or d has elapsed, whichever is first.
+	SetReadyAfter(d time.Duration) *Warmup
+
 	// LiveEndpoint is the HTTP handler for just the /live endpoint, which is
 	// useful if you need to attach it into your own HTTP handler tree.
 	LiveEndpoint(http.ResponseWriter, *http.Request)
@@ -56,4 +68,8 @@ type Handler interface {
 	// ReadyEndpoint is the HTTP handler for just the /ready endpoint, which is
 	// useful if you need to attach it into your own HTTP handler tree.
 	ReadyEndpoint(http.ResponseWriter, *http.Request)
+
+	// StartupEndpoint is the HTTP handler for just the /startup endpoint, which
+	// is useful if you need to attach it into your own HTTP handler tree.
+	StartupEndpoint(http.ResponseWriter, *http.Request)
 }
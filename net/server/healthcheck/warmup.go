@@ -0,0 +1,79 @@
+// Copyright © 2018 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWarmingUp is reported by a Warmup's check until the warmup is complete
+var ErrWarmingUp = errors.New("warming up")
+
+// Warmup is a startup grace period, during which its check fails.  It
+// completes when Done is called, e.g., once the caches are warm, or when
+// its deadline passes, whichever is first, so that an instance whose
+// warmup stalls still enters service rather than failing its startupProbe.
+type Warmup struct {
+	deadline time.Time // zero for none
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewWarmup returns a Warmup which completes at the latest after
+// maxDuration, or only when Done is called, if maxDuration is zero.
+func NewWarmup(maxDuration time.Duration) *Warmup {
+	w := &Warmup{done: make(chan struct{})}
+	if maxDuration > 0 {
+		w.deadline = time.Now().Add(maxDuration)
+	}
+
+	return w
+}
+
+// Done completes the warmup; calls after the first have no effect
+func (w *Warmup) Done() {
+	w.once.Do(func() { close(w.done) })
+}
+
+// IsComplete reports whether Done has been called or the deadline has passed
+func (w *Warmup) IsComplete() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+	}
+
+	return !w.deadline.IsZero() && !time.Now().Before(w.deadline)
+}
+
+// Check returns a check, suitable for AddStartupCheck, which fails with
+// ErrWarmingUp until the warmup is complete
+func (w *Warmup) Check() CheckWithContext {
+	return func(context.Context) error {
+		if !w.IsComplete() {
+			return ErrWarmingUp
+		}
+		return nil
+	}
+}
@@ -1,88 +1,204 @@
 package hystrix
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/afex/hystrix-go/hystrix"
 	"go.uber.org/zap"
 )
 
+// Fallback synthesizes a response, e.g., a cached copy, for a request
+// which could not be made because the circuit is open, the request
+// timed out, or too many requests are already in flight.  err is the
+// reason the request could not be made.
+type Fallback func(req *http.Request, err error) (*http.Response, error)
+
 type HTTPClient struct {
 	http.Client
 	HystrixCommandName string
 	logger             *zap.Logger
+
+	// Fallback, if set, provides the response when a request cannot be
+	// made.  If nil, the error is returned to the caller.
+	Fallback Fallback
 }
 
-func NewClient(commandName string, logger *zap.Logger) *HTTPClient {
+// NewClient returns an HTTP client whose requests are made via the
+// hystrix command commandName, configured by config
+func NewClient(commandName string, config hystrix.CommandConfig, logger *zap.Logger) *HTTPClient {
+	hystrix.ConfigureCommand(commandName, config)
+
 	return &HTTPClient{
 		HystrixCommandName: commandName,
 		logger:             logger.With(zap.String("hystrixCommand", commandName)),
 	}
 }
 
-func circuitBreaker(u, commandName string, logger *zap.Logger, fn func() (*http.Response, error)) (*http.Response, error) {
+// cancelOnClose cancels a request's context once its response body is
+// closed, rather than when the request returns
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func closeBody(response *http.Response) {
+	if response.Body != nil {
+		response.Body.Close()
+	}
+}
+
+func circuitBreaker(req *http.Request, commandName string, logger *zap.Logger, fallback Fallback, fn func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	// the request is cancelled if the caller returns without its
+	// response, e.g., after a timeout; otherwise, once the response's
+	// body is closed
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
 
-	output := make(chan *http.Response, 1)
-	defer close(output)
+	// these are not closed: after a timeout, fn may still complete.
+	// output has room for both fn's response and the fallback's.
+	output := make(chan *http.Response, 2)
 	errors := make(chan error, 1)
-	defer close(errors)
 
-	hystrix.Go(commandName, func() error {
-		response, err := fn()
+	// returned is set once the caller has gone, after which results are
+	// discarded rather than sent
+	var mu sync.Mutex
+	var returned bool
+	send := func(response *http.Response) {
+		mu.Lock()
+		defer mu.Unlock()
+		if returned {
+			closeBody(response)
+			return
+		}
+		output <- response
+	}
+
+	// set once fn has delivered a result to the caller, after which
+	// the fallback has nothing to add
+	var delivered atomic.Bool
+
+	// note the state of the circuit once the request has completed
+	defer func() { recordState(commandName, currentState(commandName), logger) }()
+
+	errc := hystrix.Go(commandName, func() error {
+		// a request made while the circuit is open is the trial which
+		// decides whether it closes again
+		if currentState(commandName) == stateOpen {
+			recordState(commandName, stateHalfOpen, logger)
+		}
+
+		response, err := fn(req)
 		if err != nil {
 			errors <- err
 		} else {
-			output <- response
-			if response.StatusCode == http.StatusInternalServerError {
-				return fmt.Errorf("error %d", response.StatusCode)
-			}
+			response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+			send(response)
+		}
+		delivered.Store(true)
+
+		if err == nil && response.StatusCode == http.StatusInternalServerError {
+			return fmt.Errorf("error %d", response.StatusCode)
 		}
 
 		return err
 	}, func(err error) error {
-		logger.Info("breaker closed", zap.String("url", u), zap.Error(err))
-		return err
+		logger.Debug("request not completed, invoking fallback", zap.String("url", req.URL.String()), zap.Error(err))
+
+		if fallback == nil || delivered.Load() {
+			return err
+		}
+
+		response, err := fallback(req, err)
+		if err != nil {
+			return err
+		}
+		send(response)
+
+		return nil
 	})
 
+	var response *http.Response
+	var err error
 	select {
-	case r := <-output:
-		return r, nil
+	case response = <-output:
+
+	case err = <-errors:
+
+	case err = <-errc:
+		// the circuit is open, the command timed out, or it failed with
+		// a response the caller should still receive
+		select {
+		case response = <-output:
+			err = nil
+		default:
+		}
+	}
 
-	case err := <-errors:
+	// close whatever arrives too late for the caller
+	mu.Lock()
+	returned = true
+	mu.Unlock()
+	for len(output) > 0 {
+		closeBody(<-output)
+	}
+
+	if response == nil {
+		cancel()
 		return nil, err
 	}
+	if _, ok := response.Body.(*cancelOnClose); !ok {
+		// a fallback's response
+		cancel()
+	}
+
+	return response, nil
 }
 
 func (c *HTTPClient) Do(r *http.Request) (*http.Response, error) {
-	return circuitBreaker(r.URL.Path, c.HystrixCommandName, c.logger, func() (*http.Response, error) {
-		return c.Client.Do(r)
-	})
+	return circuitBreaker(r, c.HystrixCommandName, c.logger, c.Fallback, c.Client.Do)
 }
 
 func (c *HTTPClient) Get(url string) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, c.logger, func() (*http.Response, error) {
-		return c.Client.Get(url)
-	})
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
 }
 
 func (c *HTTPClient) Head(url string) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, c.logger, func() (*http.Response, error) {
-		return c.Client.Head(url)
-	})
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
 
+	return c.Do(req)
 }
 
 func (c *HTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, c.logger, func() (*http.Response, error) {
-		return c.Client.Post(url, contentType, body)
-	})
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return c.Do(req)
 }
 
 func (c *HTTPClient) PostForm(url string, data url.Values) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, c.logger, func() (*http.Response, error) {
-		return c.Client.PostForm(url, data)
-	})
+	return c.Post(url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
 }
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package hystrix
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// failingBackend returns a server which fails every request
+func failingBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+}
+
+func circuitIsOpen(name string) bool {
+	circuit, _, err := hystrix.GetCircuit(name)
+	return err == nil && circuit.IsOpen()
+}
+
+func TestConfiguredThresholdTripsBreaker(t *testing.T) {
+	backend := failingBackend()
+	defer backend.Close()
+
+	const name = "TestConfiguredThresholdTripsBreaker"
+	config := DefaultCommandConfig
+	config.RequestVolumeThreshold = 3
+	config.SleepWindow = 60000
+	c := NewClient(name, config, zap.NewNop())
+
+	for i := 0; i < config.RequestVolumeThreshold; i++ {
+		resp, err := c.Get(backend.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}
+
+	// the circuit's metrics are updated asynchronously
+	assert.Eventually(t, func() bool { return circuitIsOpen(name) }, time.Second, 10*time.Millisecond)
+
+	_, err := c.Get(backend.URL)
+	assert.ErrorContains(t, err, hystrix.ErrCircuitOpen.Error())
+}
+
+func TestBreakerStaysClosedBelowThreshold(t *testing.T) {
+	backend := failingBackend()
+	defer backend.Close()
+
+	const name = "TestBreakerStaysClosedBelowThreshold"
+	config := DefaultCommandConfig
+	config.RequestVolumeThreshold = 10
+	rt := NewTransport(http.DefaultTransport, name, config, zap.NewNop())
+	c := &http.Client{Transport: rt}
+
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(backend.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, circuitIsOpen(name))
+}
+
+func TestFallbackProvidesResponse(t *testing.T) {
+	backend := failingBackend()
+	defer backend.Close()
+
+	const name = "TestFallbackProvidesResponse"
+	config := DefaultCommandConfig
+	config.RequestVolumeThreshold = 1
+	config.SleepWindow = 60000
+	c := NewClient(name, config, zap.NewNop())
+
+	resp, err := c.Get(backend.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.Eventually(t, func() bool { return circuitIsOpen(name) }, time.Second, 10*time.Millisecond)
+
+	c.Fallback = func(req *http.Request, err error) (*http.Response, error) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusNonAuthoritativeInfo)
+		return rr.Result(), nil
+	}
+
+	resp, err = c.Get(backend.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNonAuthoritativeInfo, resp.StatusCode)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
+
+// closeRecorder notes when a response body is closed
+type closeRecorder struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (b *closeRecorder) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestTimeoutCancelsRequest(t *testing.T) {
+	const name = "TestTimeoutCancelsRequest"
+	config := DefaultCommandConfig
+	config.Timeout = 20
+
+	cancelled := make(chan struct{})
+	rt := NewTransport(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+		close(cancelled)
+		return nil, r.Context().Err()
+	}), name, config, zap.NewNop())
+
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://backend/", nil))
+	assert.ErrorContains(t, err, hystrix.ErrTimeout.Error())
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the timed out request was not cancelled")
+	}
+}
+
+func TestLateResponseIsClosed(t *testing.T) {
+	const name = "TestLateResponseIsClosed"
+	config := DefaultCommandConfig
+	config.Timeout = 20
+
+	// the backend ignores the cancellation & responds after the timeout
+	release := make(chan struct{})
+	body := &closeRecorder{Reader: strings.NewReader("late"), closed: make(chan struct{})}
+	rt := NewTransport(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: body}, nil
+	}), name, config, zap.NewNop())
+
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://backend/", nil))
+	assert.ErrorContains(t, err, hystrix.ErrTimeout.Error())
+	close(release)
+
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Error("the late response's body was not closed")
+	}
+}
+
+func TestResponseOutlivesRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer backend.Close()
+
+	c := NewClient("TestResponseOutlivesRequest", DefaultCommandConfig, zap.NewNop())
+
+	// the request is not cancelled until its body has been read
+	resp, err := c.Get(backend.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+	}
+}
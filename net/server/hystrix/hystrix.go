@@ -9,15 +9,25 @@ import (
 	"go.uber.org/zap"
 )
 
+// DefaultCommandConfig is a reasonable starting point for a circuit:
+// a one second timeout, up to 100 concurrent requests, and a breaker
+// which trips when half of at least 20 requests in the rolling window
+// fail, then waits five seconds before letting a request through.
+var DefaultCommandConfig = hystrix.CommandConfig{
+	Timeout:                1000, // milliseconds
+	MaxConcurrentRequests:  100,
+	RequestVolumeThreshold: 20,
+	SleepWindow:            5000, // milliseconds
+	ErrorPercentThreshold:  50,
+}
+
 type hystrixHelper struct {
 	commandName string
 	logger      *zap.Logger
 }
 
-func NewHystrixHelper(commandName string, logger *zap.Logger) (*hystrixHelper, error) {
-	hystrix.ConfigureCommand(commandName, hystrix.CommandConfig{
-		MaxConcurrentRequests: 100,
-	})
+func NewHystrixHelper(commandName string, config hystrix.CommandConfig, logger *zap.Logger) (*hystrixHelper, error) {
+	hystrix.ConfigureCommand(commandName, config)
 
 	return &hystrixHelper{commandName: commandName,
 		logger: logger.With(zap.String("hystrixCommand", commandName))}, nil
@@ -26,6 +36,9 @@ func NewHystrixHelper(commandName string, logger *zap.Logger) (*hystrixHelper, e
 func (y *hystrixHelper) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		err := hystrix.Do(y.commandName, func() (err error) {
+			if currentState(y.commandName) == stateOpen {
+				recordState(y.commandName, stateHalfOpen, y.logger)
+			}
 
 			monitor := httpWriter.NewHTTPWriter(w)
 
@@ -38,10 +51,11 @@ func (y *hystrixHelper) Handler(h http.Handler) http.Handler {
 			}
 			return nil
 		}, func(err error) error {
-			y.logger.Warn("breaker open",
+			y.logger.Debug("request not completed, invoking fallback",
 				zap.Error(err))
 			return nil
 		})
+		recordState(y.commandName, currentState(y.commandName), y.logger)
 		if err != nil {
 			y.logger.Warn("Hystrix Error",
 				zap.Error(err))
@@ -99,6 +99,7 @@ func init() {
 	prometheus.MustRegister(hystrixFallbackFailures)
 	prometheus.MustRegister(hystrixTotalDuration)
 	prometheus.MustRegister(hystrixRunDuration)
+	prometheus.MustRegister(circuitTransitions)
 }
 
 func (h *hystrixHelper) IncrementAttempts() {
@@ -24,7 +24,6 @@
 package hystrix
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/afex/hystrix-go/hystrix"
@@ -35,10 +34,17 @@ type Transport struct {
 	transport          http.RoundTripper
 	logger             *zap.Logger
 	hystrixCommandName string
+
+	// Fallback, if set, provides the response when a request cannot be
+	// made.  If nil, the error is returned to the caller.
+	Fallback Fallback
 }
 
-// NewTransport creates a hystrix-wrapped transport
-func NewTransport(rt http.RoundTripper, commandName string, logger *zap.Logger) http.RoundTripper {
+// NewTransport creates a hystrix-wrapped transport, whose requests
+// are made via the hystrix command commandName, configured by config
+func NewTransport(rt http.RoundTripper, commandName string, config hystrix.CommandConfig, logger *zap.Logger) *Transport {
+	hystrix.ConfigureCommand(commandName, config)
+
 	t := &Transport{
 		transport:          rt,
 		logger:             logger.With(zap.String("commandName", commandName)),
@@ -48,44 +54,6 @@ func NewTransport(rt http.RoundTripper, commandName string, logger *zap.Logger)
 	return t
 }
 
-func (t *Transport) circuitBreak(req *http.Request, fn func() (*http.Response, error)) (*http.Response, error) {
-
-	output := make(chan *http.Response, 1)
-	defer close(output)
-	errors := make(chan error, 1)
-	defer close(errors)
-
-	hystrix.Go(t.hystrixCommandName, func() error {
-		response, err := fn()
-		if err != nil {
-			errors <- err
-		} else {
-			output <- response
-			if response.StatusCode == http.StatusInternalServerError {
-				return fmt.Errorf("error %d", response.StatusCode)
-			}
-		}
-
-		return err
-	}, func(err error) error {
-		t.logger.Info("breaker closed",
-			zap.String("url",
-				req.URL.String()),
-			zap.Error(err))
-		return err
-	})
-
-	select {
-	case r := <-output:
-		return r, nil
-
-	case err := <-errors:
-		return nil, err
-	}
-}
-
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	return t.circuitBreak(req, func() (*http.Response, error) {
-		return t.transport.RoundTrip(req)
-	})
+	return circuitBreaker(req, t.hystrixCommandName, t.logger, t.Fallback, t.transport.RoundTrip)
 }
@@ -0,0 +1,71 @@
+package hystrix
+
+import (
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// circuit states, as reported in the transition log & metric
+const (
+	stateClosed   = "closed"
+	stateOpen     = "open"
+	stateHalfOpen = "half-open"
+)
+
+var circuitTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hystrix_circuit_transitions_total",
+		Help: "Number of times a circuit breaker has changed state.",
+	},
+	[]string{"command", "to_state"},
+)
+
+// circuitStates holds the last observed state of each circuit.
+// hystrix-go offers no notification of state changes, so each
+// command execution compares the circuit's state with this one.
+var circuitStates = struct {
+	sync.Mutex
+	last map[string]string
+}{last: make(map[string]string)}
+
+// currentState returns whether commandName's circuit is open or closed
+func currentState(commandName string) string {
+	circuit, _, err := hystrix.GetCircuit(commandName)
+	if err == nil && circuit.IsOpen() {
+		return stateOpen
+	}
+
+	return stateClosed
+}
+
+// recordState logs and counts a change in the state of commandName's circuit.
+// Every circuit starts out closed.
+func recordState(commandName, state string, logger *zap.Logger) {
+	circuitStates.Lock()
+	previous, ok := circuitStates.last[commandName]
+	circuitStates.last[commandName] = state
+	circuitStates.Unlock()
+
+	if !ok {
+		previous = stateClosed
+	}
+	if previous == state {
+		return
+	}
+
+	circuitTransitions.WithLabelValues(commandName, state).Inc()
+
+	fields := []zap.Field{
+		zap.String("hystrixCommand", commandName),
+		zap.String("from", previous),
+		zap.String("to", state),
+	}
+	if state == stateOpen {
+		logger.Warn("circuit breaker state changed", fields...)
+	} else {
+		logger.Info("circuit breaker state changed", fields...)
+	}
+}
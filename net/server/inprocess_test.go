@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+func TestNewInProcessClient(t *testing.T) {
+	called := false
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		called = true
+		return handler(ctx, req)
+	}
+
+	conn, cleanup, err := NewInProcessClient(func(g *grpc.Server) error {
+		healthgrpc.RegisterHealthServer(g, health.NewServer())
+		return nil
+	}, WithLogger(zap.NewNop()), WithRPCUnaryInterceptors(interceptor))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := healthgrpc.NewHealthClient(conn).Check(ctx, &healthgrpc.HealthCheckRequest{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, healthgrpc.HealthCheckResponse_SERVING, resp.Status)
+	}
+	assert.True(t, called, "the interceptor chain should have been invoked")
+}
+
+func TestCorrelationIDResponseHeader(t *testing.T) {
+	conn, cleanup, err := NewInProcessClient(func(g *grpc.Server) error {
+		healthgrpc.RegisterHealthServer(g, health.NewServer())
+		return nil
+	}, WithLogger(zap.NewNop()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const corrID = "test-correlation-id"
+	ctx = metadata.AppendToOutgoingContext(ctx, correlationID.CORRID, corrID)
+
+	var header metadata.MD
+	_, err = healthgrpc.NewHealthClient(conn).Check(ctx, &healthgrpc.HealthCheckRequest{}, grpc.Header(&header))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{corrID}, header.Get(correlationID.CORRID))
+	}
+}
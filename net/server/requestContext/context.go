@@ -0,0 +1,79 @@
+// Copyright © 2024 Mike Hudgins <mchudgins@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package requestContext holds the values which describe a request --
+// its correlation ID, user, start time, trace ID & baggage -- under a single
+// context key.  The correlationID, user and requestTS packages store
+// their values here, so middleware which sets several of them at once
+// can do so with one context.WithValue.
+package requestContext
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey struct{}
+
+var key contextKey
+
+// RequestContext bundles the per-request values carried in a context
+type RequestContext struct {
+	CorrelationID string
+	User          string
+	Start         time.Time // when the request was received
+	TraceID       string
+
+	// Baggage is shared by copies of the RequestContext, so it must be
+	// replaced, rather than modified, when updated (see package baggage)
+	Baggage map[string]string
+}
+
+// FromContext returns a copy of the RequestContext carried by ctx,
+// or the zero value if there is none
+func FromContext(ctx context.Context) RequestContext {
+	if ctx == nil {
+		return RequestContext{}
+	}
+
+	if rc, ok := ctx.Value(key).(*RequestContext); ok {
+		return *rc
+	}
+
+	return RequestContext{}
+}
+
+// NewContext returns a new Context that carries rc
+func NewContext(ctx context.Context, rc RequestContext) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, key, &rc)
+}
+
+// Update returns a new Context carrying the RequestContext of ctx as
+// modified by fn.  The RequestContext of ctx itself is unchanged.
+func Update(ctx context.Context, fn func(rc *RequestContext)) context.Context {
+	rc := FromContext(ctx)
+	fn(&rc)
+
+	return NewContext(ctx, rc)
+}
@@ -23,23 +23,23 @@ package requestTS
 import (
 	"context"
 	"time"
-)
-
-type contextKey struct{}
 
-var key contextKey
+	"github.com/mchudgins/go/net/server/requestContext"
+)
 
 // FromContext returns the request's receipt timestamp, if one exists in the context
 // The timestamp is added to the context by the github.com/mchudgins/go/net/handler accessLogger.
 func FromContext(ctx context.Context) time.Time {
-	val, ok := ctx.Value(key).(time.Time)
-	if ok {
-		return val
+	ts := requestContext.FromContext(ctx).Start
+	if ts.IsZero() {
+		return time.Unix(0, 0)
 	}
 
-	return time.Unix(0, 0)
+	return ts
 }
 
 func NewContext(ctx context.Context, ts time.Time) context.Context {
-	return context.WithValue(ctx, key, ts)
+	return requestContext.Update(ctx, func(rc *requestContext.RequestContext) {
+		rc.Start = ts
+	})
 }
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runtimeCollector exports goroutine, GC pause & heap statistics labeled
+// with the service name.  The names are prefixed "runtime_", rather than
+// "go_", so they don't collide with the client library's own Go collector.
+type runtimeCollector struct {
+	goroutines *prometheus.Desc
+	gcPause    *prometheus.Desc
+	heapAlloc  *prometheus.Desc
+	heapInuse  *prometheus.Desc
+	heapObject *prometheus.Desc
+}
+
+// gcPauseQuantiles are the quantiles of debug.GCStats.PauseQuantiles
+// when it has room for five
+var gcPauseQuantiles = []float64{0, 0.25, 0.5, 0.75, 1}
+
+func newRuntimeCollector(service string) *runtimeCollector {
+	labels := prometheus.Labels{"service": service}
+
+	return &runtimeCollector{
+		goroutines: prometheus.NewDesc("runtime_goroutines",
+			"Number of goroutines that currently exist.", nil, labels),
+		gcPause: prometheus.NewDesc("runtime_gc_pause_seconds",
+			"Distribution of the GC stop-the-world pause durations.", nil, labels),
+		heapAlloc: prometheus.NewDesc("runtime_heap_alloc_bytes",
+			"Bytes of allocated heap objects.", nil, labels),
+		heapInuse: prometheus.NewDesc("runtime_heap_inuse_bytes",
+			"Bytes in in-use heap spans.", nil, labels),
+		heapObject: prometheus.NewDesc("runtime_heap_objects",
+			"Number of allocated heap objects.", nil, labels),
+	}
+}
+
+func (c *runtimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.goroutines
+	ch <- c.gcPause
+	ch <- c.heapAlloc
+	ch <- c.heapInuse
+	ch <- c.heapObject
+}
+
+func (c *runtimeCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.goroutines, prometheus.GaugeValue, float64(runtime.NumGoroutine()))
+
+	stats := debug.GCStats{PauseQuantiles: make([]time.Duration, len(gcPauseQuantiles))}
+	debug.ReadGCStats(&stats)
+	quantiles := make(map[float64]float64, len(gcPauseQuantiles))
+	for i, q := range gcPauseQuantiles {
+		quantiles[q] = stats.PauseQuantiles[i].Seconds()
+	}
+	ch <- prometheus.MustNewConstSummary(c.gcPause, uint64(stats.NumGC), stats.PauseTotal.Seconds(), quantiles)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	ch <- prometheus.MustNewConstMetric(c.heapAlloc, prometheus.GaugeValue, float64(mem.HeapAlloc))
+	ch <- prometheus.MustNewConstMetric(c.heapInuse, prometheus.GaugeValue, float64(mem.HeapInuse))
+	ch <- prometheus.MustNewConstMetric(c.heapObject, prometheus.GaugeValue, float64(mem.HeapObjects))
+}
+
+// registerRuntimeCollector registers the runtime collector for the service,
+// unless another server in this process already has
+func registerRuntimeCollector(r prometheus.Registerer, service string) error {
+	err := r.Register(newRuntimeCollector(service))
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return nil
+	}
+
+	return err
+}
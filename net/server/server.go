@@ -21,31 +21,39 @@
 package server
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
 	"crypto/tls"
+	"errors"
 	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	afex "github.com/afex/hystrix-go/hystrix"
-	"github.com/gorilla/handlers"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 
 	ecconet "github.com/mchudgins/go/net"
 	gsh "github.com/mchudgins/go/net/server/handler"
+	"github.com/mchudgins/go/version"
 )
 
 // Config holds the set of options used by a server
@@ -71,7 +79,44 @@ type Config struct {
 	metricsHandler          http.Handler
 	shutdown                chan struct{}
 	wg                      *sync.WaitGroup
+	shutdownCtx             context.Context
 	RPCUnaryInterceptorList []grpc.UnaryServerInterceptor
+	shutdownHooks           []ShutdownHook
+	exitOnShutdown          bool
+	listenConfig            net.ListenConfig
+	drainer                 *gsh.Drainer
+	metricsAuth             func(*http.Request) bool
+	maxHeaderBytes          int
+	accessLogOptions        []gsh.AccessLogOption
+	rpcCredentials          credentials.TransportCredentials
+	rpcMaxConnectionAge     time.Duration
+	started                 time.Time // when Run was called, for the lifecycle events
+	hystrixStream           bool
+	hystrixStreamOrigins    []string
+	hystrixStreamHandler    *afex.StreamHandler
+	maxConnections          int
+	httpTimeouts            httpTimeouts
+	clientCertUser          bool
+	clientCertOptions       []gsh.ClientCertOption
+	requestRecorder         *gsh.RequestRecorder
+	environment             string
+	runtimeMetrics          bool
+	registry                *prometheus.Registry
+	metricsTLS              bool
+	metricsCertFilename     string
+	metricsKeyFilename      string
+	metricsClientAuth       tls.ClientAuthType
+	rpcClientAuth           tls.ClientAuthType
+	gzipOptions             gsh.ChainOption // nil for the defaults of WithGzip
+	minimal                 bool
+	metricsRoutes           map[string]http.Handler
+	httpMetricsOptions      []gsh.MetricsOption
+	sniCertificates         map[string]CertKeyPair
+	publicEndpoint          bool // WithPublicEndpoint, which is exclusive of WithTLSConfig
+	customTLSConfig         bool // WithTLSConfig
+	drainHooks              []gsh.DrainHook
+	boundAddr               func(kind ServerKind, addr net.Addr)
+	requireHTTPS            gsh.ChainOption
 }
 
 // Option permits changes from the default Config
@@ -81,8 +126,30 @@ type Option func(*Config) error
 // the gRPC registration function
 type RPCRegistration func(*grpc.Server) error
 
+// errMutuallyExclusive reports the use of two options which may not be combined
+func errMutuallyExclusive(a, b string) error {
+	return fmt.Errorf("%s and %s are mutually exclusive", a, b)
+}
+
+// ErrNoServers is returned by Run when none of the HTTP,
+// gRPC or metrics servers have been configured
+var ErrNoServers = errors.New("no servers configured")
+
+// ShutdownHook is used with WithShutdownHook and is invoked
+// during graceful shutdown. The context expires when the
+// shutdown wait time has elapsed.
+type ShutdownHook func(ctx context.Context) error
+
 const (
 	zipkinHTTPEndpoint = "http://localhost:9411/api/v1/spans"
+
+	// defaultReadHeaderTimeout bounds the time a client may take to send
+	// the request headers (slowloris protection)
+	defaultReadHeaderTimeout = 250 * time.Millisecond
+
+	// rpcMaxConnectionAgeGrace is the time permitted for in-flight RPCs
+	// to complete once a connection has reached its maximum age
+	rpcMaxConnectionAgeGrace = 30 * time.Second
 )
 
 // WithCanonicalHost causes the server to redirect to the specified
@@ -96,10 +163,32 @@ func WithCanonicalHost(hostname string) Option {
 	}
 }
 
+// WithRequireHTTPS allows only HTTP requests made over TLS, either to
+// this server or to a TLS-terminating proxy at one of trustedProxies
+// (addresses or CIDR ranges), as reported by its X-Forwarded-Proto
+// header.  Plaintext requests are redirected to https or rejected (see
+// gsh.RequireHTTPS); with WithCanonicalHost, the redirect is directly to
+// the canonical host.
+func WithRequireHTTPS(mode gsh.RedirectOrReject, trustedProxies ...string) Option {
+	return func(cfg *Config) error {
+		if _, err := gsh.ParseTrustedProxies(trustedProxies...); err != nil {
+			return err
+		}
+
+		cfg.requireHTTPS = gsh.WithRequireHTTPS(mode, gsh.WithTrustedProxies(trustedProxies...))
+		return nil
+	}
+}
+
 // WithCertificate provides the x509 public/private keypair.
 // also ensures the HTTP/GRPC endpoints use TLS.
+// Mutually exclusive with WithRPCCredentials.
 func WithCertificate(certFilename, keyFilename string) Option {
 	return func(cfg *Config) error {
+		if cfg.rpcCredentials != nil {
+			return errMutuallyExclusive("WithCertificate", "WithRPCCredentials")
+		}
+
 		cfg.CertFilename = certFilename
 		cfg.KeyFilename = keyFilename
 		cfg.Insecure = false
@@ -108,7 +197,9 @@ func WithCertificate(certFilename, keyFilename string) Option {
 }
 
 // WithRequestClientCert indicates that the client should send
-// a cert, if available.  Only useful if WithCertificate has been set
+// a cert, if available.  Only useful if WithCertificate has been set.
+// It applies to the HTTP server; the gRPC server always requests a
+// cert (see WithRPCClientAuth).
 func WithRequestClientCert() Option {
 	return func(cfg *Config) error {
 		cfg.clientAuth = tls.VerifyClientCertIfGiven
@@ -116,7 +207,55 @@ func WithRequestClientCert() Option {
 	}
 }
 
-// WithHTTPListenPort changes the listen port
+// WithClientCertUser identifies HTTP users by their verified client
+// certificates, as the gRPC server does, and requests a certificate from
+// clients (see WithRequestClientCert).  With gsh.RequireClientCert,
+// requests without one are rejected.
+func WithClientCertUser(options ...gsh.ClientCertOption) Option {
+	return func(cfg *Config) error {
+		cfg.clientCertUser = true
+		cfg.clientCertOptions = append(cfg.clientCertOptions, options...)
+		if cfg.clientAuth == tls.NoClientCert {
+			cfg.clientAuth = tls.VerifyClientCertIfGiven
+		}
+		return nil
+	}
+}
+
+// ServerKind identifies one of the servers started by Run
+type ServerKind int
+
+const (
+	KindHTTP ServerKind = iota
+	KindRPC
+	KindMetrics
+)
+
+func (k ServerKind) String() string {
+	switch k {
+	case KindHTTP:
+		return "http"
+	case KindRPC:
+		return "rpc"
+	case KindMetrics:
+		return "metrics"
+	}
+	return "ServerKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// WithBoundAddr calls fn with the address bound by each configured server,
+// once all are bound and before any serves.  With a listen port of 0, the
+// system chooses an ephemeral port, which this reports, e.g., so that
+// tests can run in parallel without port conflicts.
+func WithBoundAddr(fn func(kind ServerKind, addr net.Addr)) Option {
+	return func(cfg *Config) error {
+		cfg.boundAddr = fn
+		return nil
+	}
+}
+
+// WithHTTPListenPort changes the listen port; 0 binds an ephemeral port
+// (see WithBoundAddr)
 func WithHTTPListenPort(port int) Option {
 	return func(cfg *Config) error {
 		cfg.HTTPListenPort = port
@@ -136,7 +275,7 @@ func WithHTTPServer(h http.Handler) Option {
 		cfg.httpServer = &http.Server{
 			IdleTimeout:       120 * time.Second,
 			ReadTimeout:       500 * time.Millisecond,
-			ReadHeaderTimeout: 250 * time.Millisecond,
+			ReadHeaderTimeout: defaultReadHeaderTimeout,
 			WriteTimeout:      2500 * time.Millisecond,
 			TLSConfig:         cfg.tlsConfig,
 		}
@@ -145,7 +284,26 @@ func WithHTTPServer(h http.Handler) Option {
 	}
 }
 
-// WithLogger sets the zap logger
+// WithHTTPTimeouts overrides the read, write and idle timeouts of the
+// HTTP server; a zero duration leaves that timeout at its default
+func WithHTTPTimeouts(read, write, idle time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.httpTimeouts = httpTimeouts{read: read, write: write, idle: idle}
+		return nil
+	}
+}
+
+// WithListenConfig provides the net.ListenConfig used to create
+// the HTTP, gRPC and metrics listeners.  Its Control func may be
+// used to set socket options, e.g., SO_REUSEPORT on Linux.
+func WithListenConfig(lc net.ListenConfig) Option {
+	return func(cfg *Config) error {
+		cfg.listenConfig = lc
+		return nil
+	}
+}
+
+// WithLogger sets the zap logger.  If not provided, nothing is logged.
 func WithLogger(l *zap.Logger) Option {
 	return func(cfg *Config) error {
 		cfg.logger = l
@@ -153,7 +311,83 @@ func WithLogger(l *zap.Logger) Option {
 	}
 }
 
-// WithMetricsListenPort changes the listen port for /metrics
+// WithMaxConnections limits the HTTP and gRPC servers to n simultaneous
+// connections each; further connections wait to be accepted until one
+// of the n closes.  By default, the number of connections is unlimited.
+func WithMaxConnections(n int) Option {
+	return func(cfg *Config) error {
+		cfg.maxConnections = n
+		return nil
+	}
+}
+
+// WithMaxHeaderBytes limits the size of the request headers accepted
+// by the HTTP and metrics servers.  If not set, net/http's default
+// of 1MB applies.
+func WithMaxHeaderBytes(n int) Option {
+	return func(cfg *Config) error {
+		cfg.maxHeaderBytes = n
+		return nil
+	}
+}
+
+// WithMetricsAuth restricts access to the metrics server (/metrics,
+// /debug/vars, /debug/config, /debug/requests & /hystrix, if enabled, and
+// the WithMetricsHandler handlers) to requests for which fn returns true;
+// others receive 401 Unauthorized.  The WithMetricsServer handler, which
+// serves the liveness & readiness probes, remains open, since the kubelet
+// cannot authenticate.  By default the metrics server is open, which
+// exposes internal details to anyone able to reach the port -- use this
+// option unless that port is isolated from untrusted networks.
+func WithMetricsAuth(fn func(*http.Request) bool) Option {
+	return func(cfg *Config) error {
+		cfg.metricsAuth = fn
+		return nil
+	}
+}
+
+// BearerTokenAuth returns a func, suitable for WithMetricsAuth,
+// which accepts requests bearing the given token
+func BearerTokenAuth(token string) func(*http.Request) bool {
+	expected := []byte("Bearer " + token)
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) == 1
+	}
+}
+
+// WithMetricsTLS serves the metrics server over TLS using the keypair
+// provided by WithCertificate (or WithMetricsCertificate), one of which is
+// required.  By default, the metrics server uses plain HTTP.
+func WithMetricsTLS() Option {
+	return func(cfg *Config) error {
+		cfg.metricsTLS = true
+		return nil
+	}
+}
+
+// WithMetricsCertificate serves the metrics server over TLS using a
+// keypair other than the one provided by WithCertificate
+func WithMetricsCertificate(certFilename, keyFilename string) Option {
+	return func(cfg *Config) error {
+		cfg.metricsTLS = true
+		cfg.metricsCertFilename = certFilename
+		cfg.metricsKeyFilename = keyFilename
+		return nil
+	}
+}
+
+// WithMetricsClientAuth sets the client certificate policy of the
+// metrics server when it uses TLS, e.g., tls.RequireAndVerifyClientCert
+// for mutual TLS.
+func WithMetricsClientAuth(clientAuth tls.ClientAuthType) Option {
+	return func(cfg *Config) error {
+		cfg.metricsClientAuth = clientAuth
+		return nil
+	}
+}
+
+// WithMetricsListenPort changes the listen port for /metrics; 0 binds
+// an ephemeral port (see WithBoundAddr)
 func WithMetricsListenPort(port int) Option {
 	return func(cfg *Config) error {
 		cfg.MetricsListenPort = port
@@ -169,7 +403,166 @@ func WithMetricsServer(h http.Handler) Option {
 	}
 }
 
-// WithRPCListenPort changes the listen port for gRPC
+// WithMinimal runs only the HTTP and/or gRPC servers, with access logging,
+// for small sidecars & agents.  It disables:
+//
+//   - /metrics, /debug/vars, /debug/config, the hystrix stream &
+//     /debug/requests; the metrics server, if WithMetricsServer was
+//     provided, serves only its handler, i.e., the liveness & readiness
+//     probes
+//   - the prometheus HTTP request & connection metrics
+//   - the prometheus gRPC interceptors
+//   - WithRuntimeMetrics
+//
+// The options which it would make inert -- WithMetricsHandler,
+// WithMetricsAuth, WithMetricsRegistry, WithHystrixStream,
+// WithRequestTracing, WithRuntimeMetrics & WithUserAgentMetrics -- may not
+// be used with it.  The collectors which packages register with prometheus
+// when initialized remain registered, but they start no goroutines and are
+// never updated.
+func WithMinimal() Option {
+	return func(cfg *Config) error {
+		cfg.minimal = true
+		return nil
+	}
+}
+
+// builtinMetricsPaths are the paths the metrics server reserves
+var builtinMetricsPaths = []string{"/", "/metrics", "/hystrix", "/debug/vars", "/debug/requests", debugConfigPath}
+
+// WithMetricsHandler mounts h at path on the metrics server, alongside
+// /metrics, e.g., for a dump of a cache or the current configuration,
+// which shouldn't be served on the public port.  It may be used more than
+// once, but path may not be one of the built-in paths, repeat another
+// WithMetricsHandler nor be an invalid or conflicting ServeMux pattern.
+// A path ending in "/" matches every path beneath it.  It requires
+// WithMetricsServer, and WithMetricsAuth applies to h as well.
+func WithMetricsHandler(path string, h http.Handler) Option {
+	return func(cfg *Config) error {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("metrics handler path %q must begin with \"/\"", path)
+		}
+		for _, builtin := range builtinMetricsPaths {
+			if path == builtin {
+				return fmt.Errorf("metrics handler path %q is reserved", path)
+			}
+		}
+		if _, ok := cfg.metricsRoutes[path]; ok {
+			return fmt.Errorf("metrics handler path %q is already registered", path)
+		}
+		if err := cfg.checkMetricsPattern(path); err != nil {
+			return err
+		}
+
+		if cfg.metricsRoutes == nil {
+			cfg.metricsRoutes = make(map[string]http.Handler)
+		}
+		cfg.metricsRoutes[path] = h
+
+		return nil
+	}
+}
+
+// checkMetricsPattern registers path, with the built-in paths & the other
+// WithMetricsHandler paths, on a throwaway ServeMux, which panics if the
+// pattern is invalid or conflicts with another, so that the metrics server
+// will not
+func (cfg *Config) checkMetricsPattern(path string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("metrics handler path %q is not a valid pattern -- %v", path, r)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	for _, builtin := range builtinMetricsPaths {
+		mux.Handle(builtin, http.NotFoundHandler())
+	}
+	for registered := range cfg.metricsRoutes {
+		mux.Handle(registered, http.NotFoundHandler())
+	}
+	mux.Handle(path, http.NotFoundHandler())
+
+	return nil
+}
+
+// WithHystrixStream serves the hystrix event stream at /hystrix on the
+// metrics server, for services which use circuit breakers.
+func WithHystrixStream() Option {
+	return func(cfg *Config) error {
+		cfg.hystrixStream = true
+		return nil
+	}
+}
+
+// WithHystrixStreamOrigins permits a dashboard served from any of origins,
+// e.g., "https://ops.example.com", to read the hystrix event stream.  An
+// origin of "*" permits any site, but only without credentials.  With
+// WithMetricsAuth, the stream itself requires credentials, but the
+// preflight requests of the permitted origins do not.  Implies
+// WithHystrixStream.
+func WithHystrixStreamOrigins(origins ...string) Option {
+	return func(cfg *Config) error {
+		cfg.hystrixStream = true
+		cfg.hystrixStreamOrigins = append(cfg.hystrixStreamOrigins, origins...)
+		return nil
+	}
+}
+
+// WithRequestTracing keeps the last n HTTP & gRPC requests in memory and
+// serves them at /debug/requests on the metrics server, as HTML or JSON
+func WithRequestTracing(n int) Option {
+	return func(cfg *Config) error {
+		cfg.requestRecorder = gsh.NewRequestRecorder(n)
+		cfg.accessLogOptions = append(cfg.accessLogOptions, gsh.WithRequestRecorder(cfg.requestRecorder))
+		return nil
+	}
+}
+
+// WithRPCCredentials provides the transport credentials for the gRPC
+// server, e.g., from a secret manager or the SPIFFE workload API.
+// Mutually exclusive with WithCertificate.
+func WithRPCCredentials(creds credentials.TransportCredentials) Option {
+	return func(cfg *Config) error {
+		if len(cfg.CertFilename) > 0 {
+			return errMutuallyExclusive("WithCertificate", "WithRPCCredentials")
+		}
+
+		cfg.rpcCredentials = creds
+		return nil
+	}
+}
+
+// WithRPCClientAuth sets the client certificate policy of the gRPC server,
+// independently of the HTTP server's, when it uses the certificate from
+// WithCertificate.  The default is tls.VerifyClientCertIfGiven.  It has no
+// effect with WithRPCCredentials, whose credentials carry their own policy.
+func WithRPCClientAuth(clientAuth tls.ClientAuthType) Option {
+	return func(cfg *Config) error {
+		cfg.rpcClientAuth = clientAuth
+		return nil
+	}
+}
+
+// WithRPCRequireClientCert enforces mutual TLS on the gRPC server:
+// connections without a verified client certificate are refused,
+// whatever the HTTP server's policy
+func WithRPCRequireClientCert() Option {
+	return WithRPCClientAuth(tls.RequireAndVerifyClientCert)
+}
+
+// WithRPCMaxConnectionAge gracefully closes gRPC connections once they are
+// about d old (gRPC adds +/-10% jitter), so that clients reconnect and their
+// load is spread across new instances after a rolling restart.
+func WithRPCMaxConnectionAge(d time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.rpcMaxConnectionAge = d
+		return nil
+	}
+}
+
+// WithRPCListenPort changes the listen port for gRPC; 0 binds an
+// ephemeral port (see WithBoundAddr)
 func WithRPCListenPort(port int) Option {
 	return func(cfg *Config) error {
 		cfg.RPCListenPort = port
@@ -196,7 +589,9 @@ func WithRPCUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Optio
 	}
 }
 
-// WithGzip compresses responses if Accept-Encoding indicates it is desired
+// WithGzip compresses responses if Accept-Encoding indicates it is desired.
+// By default, text, JSON & JavaScript responses of at least
+// handler.DefaultCompressMinSize bytes are compressed at the default level.
 func WithGzip() Option {
 	return func(cfg *Config) error {
 		cfg.Compress = true
@@ -205,6 +600,83 @@ func WithGzip() Option {
 	}
 }
 
+// WithGzipOptions compresses responses, of the given content types and at
+// least minSize bytes, at the given gzip level (see handler.Compress),
+// if Accept-Encoding indicates it is desired
+func WithGzipOptions(level int, minSize int, contentTypes []string) Option {
+	return func(cfg *Config) error {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return fmt.Errorf("invalid gzip compression level %d", level)
+		}
+		if minSize < 0 {
+			return fmt.Errorf("gzip minimum size may not be negative (%d)", minSize)
+		}
+
+		cfg.Compress = true
+		cfg.gzipOptions = gsh.WithCompressionOptions(level, minSize, contentTypes)
+
+		return nil
+	}
+}
+
+// WithAccessLogOptions customizes the HTTP & RPC access logs, e.g.,
+// with gsh.WithSampling or gsh.WithLogLevel
+func WithAccessLogOptions(options ...gsh.AccessLogOption) Option {
+	return func(cfg *Config) error {
+		cfg.accessLogOptions = append(cfg.accessLogOptions, options...)
+		return nil
+	}
+}
+
+// WithRedactedMetadata replaces the set of gRPC metadata keys
+// (by default, authorization and cookie) whose values are omitted
+// from the RPC access log
+func WithRedactedMetadata(keys ...string) Option {
+	return func(cfg *Config) error {
+		cfg.accessLogOptions = append(cfg.accessLogOptions, gsh.WithRedactedMetadata(keys...))
+		return nil
+	}
+}
+
+// WithInboundBaggage accepts the baggage of HTTP & RPC requests from the
+// given addresses or CIDR ranges, or, if none are given, from every caller
+// (see gsh.WithInboundBaggage).  By default, inbound baggage is ignored.
+func WithInboundBaggage(peers ...string) Option {
+	return func(cfg *Config) error {
+		if _, err := gsh.ParseTrustedProxies(peers...); err != nil {
+			return err
+		}
+
+		cfg.accessLogOptions = append(cfg.accessLogOptions, gsh.WithInboundBaggage(peers...))
+		return nil
+	}
+}
+
+// WithServerTiming adds a Server-Timing header, with the server's
+// processing time, to HTTP responses
+func WithServerTiming() Option {
+	return func(cfg *Config) error {
+		cfg.accessLogOptions = append(cfg.accessLogOptions, gsh.WithServerTiming())
+		return nil
+	}
+}
+
+// WithUserAgentMetrics counts HTTP requests by category of User-Agent
+// (see gsh.WithUserAgentMetrics), with gsh.DefaultUserAgentCategories if no
+// categories are provided
+func WithUserAgentMetrics(categories ...gsh.UserAgentCategory) Option {
+	return func(cfg *Config) error {
+		for _, c := range categories {
+			if len(c.Name) == 0 || c.Pattern == nil {
+				return fmt.Errorf("user agent categories require a name & pattern")
+			}
+		}
+
+		cfg.httpMetricsOptions = append(cfg.httpMetricsOptions, gsh.WithUserAgentMetrics(categories...))
+		return nil
+	}
+}
+
 // WithServiceName sets the Tracer service name
 func WithServiceName(serviceName string) Option {
 	return func(cfg *Config) error {
@@ -222,9 +694,15 @@ func WithTracer() Option {
 }
 
 // WithPublicEndpoint informs the server that requests
-// are arriving directly from the internet
+// are arriving directly from the internet.
+// Mutually exclusive with WithTLSConfig.
 func WithPublicEndpoint() Option {
 	return func(cfg *Config) error {
+		if cfg.customTLSConfig {
+			return errMutuallyExclusive("WithTLSConfig", "WithPublicEndpoint")
+		}
+
+		cfg.publicEndpoint = true
 		cfg.Insecure = false
 		cfg.tlsConfig = ecconet.NewPublicTLSConfig()
 
@@ -240,6 +718,77 @@ func WithPublicEndpoint() Option {
 	}
 }
 
+// WithDrainer provides the Drainer used to reject new HTTP requests
+// once shutdown has begun.  Share it with the readiness checks
+// (see Drainer.ReadinessCheck) so that the instance reports itself
+// not-ready at the same moment.
+func WithDrainer(d *gsh.Drainer) Option {
+	return func(cfg *Config) error {
+		cfg.drainer = d
+		return nil
+	}
+}
+
+// WithDrainHooks annotates the HTTP responses written once shutdown has
+// begun, e.g., with gsh.CloseConnection, which hastens the reconnection
+// of keep-alive clients to another instance (see Drainer.OnDrain)
+func WithDrainHooks(hooks ...gsh.DrainHook) Option {
+	return func(cfg *Config) error {
+		cfg.drainHooks = append(cfg.drainHooks, hooks...)
+		return nil
+	}
+}
+
+// WithEnvironment tags the server's log entries with an "env" field
+// and the metrics it serves with an "env" label, e.g., "staging"
+func WithEnvironment(env string) Option {
+	return func(cfg *Config) error {
+		cfg.environment = env
+		return nil
+	}
+}
+
+// WithRuntimeMetrics exports goroutine, GC pause & heap statistics,
+// labeled with the service name (see WithServiceName)
+func WithRuntimeMetrics() Option {
+	return func(cfg *Config) error {
+		cfg.runtimeMetrics = true
+		return nil
+	}
+}
+
+// WithMetricsRegistry registers the server's own collectors, e.g., those of
+// WithRuntimeMetrics, with reg rather than the default registry.  The
+// metrics server serves both.
+func WithMetricsRegistry(reg *prometheus.Registry) Option {
+	return func(cfg *Config) error {
+		cfg.registry = reg
+		return nil
+	}
+}
+
+// WithExitOnShutdown controls whether the process exits when the
+// graceful shutdown does not complete in time (the default). When false,
+// Run returns the error instead, so that tests and embedding programs
+// can observe the shutdown and perform their own cleanup.
+func WithExitOnShutdown(exit bool) Option {
+	return func(cfg *Config) error {
+		cfg.exitOnShutdown = exit
+		return nil
+	}
+}
+
+// WithShutdownHook adds a function to be run during graceful shutdown,
+// e.g., to flush buffers or deregister from service discovery.
+// Hooks run in the order added, before the servers are stopped.
+// Errors are logged, but do not prevent the remaining hooks from running.
+func WithShutdownHook(fn ShutdownHook) Option {
+	return func(cfg *Config) error {
+		cfg.shutdownHooks = append(cfg.shutdownHooks, fn)
+		return nil
+	}
+}
+
 func WithShutdownSignal(c chan struct{}, wg *sync.WaitGroup) Option {
 	return func(cfg *Config) error {
 		cfg.shutdown = c
@@ -249,10 +798,25 @@ func WithShutdownSignal(c chan struct{}, wg *sync.WaitGroup) Option {
 	}
 }
 
+// WithShutdownContext initiates a graceful shutdown when ctx is done,
+// in addition to the usual signals or shutdown channel.
+func WithShutdownContext(ctx context.Context) Option {
+	return func(cfg *Config) error {
+		cfg.shutdownCtx = ctx
+
+		return nil
+	}
+}
+
 // WithTLSConfig allows a specific tls.Config to be used.
 // Mutually exclusive with WithPublicEndpoint.
 func WithTLSConfig(tlsConfig *tls.Config) Option {
 	return func(cfg *Config) error {
+		if cfg.publicEndpoint {
+			return errMutuallyExclusive("WithTLSConfig", "WithPublicEndpoint")
+		}
+
+		cfg.customTLSConfig = true
 		cfg.Insecure = false
 		cfg.tlsConfig = tlsConfig
 
@@ -260,9 +824,8 @@ func WithTLSConfig(tlsConfig *tls.Config) Option {
 	}
 }
 
-// Run starts the configured servers.
-func Run(opts ...Option) {
-
+// newConfig returns the default config, modified by opts
+func newConfig(opts ...Option) *Config {
 	// default config
 	cfg := &Config{
 		Insecure:          true,
@@ -270,9 +833,12 @@ func Run(opts ...Option) {
 		MetricsListenPort: 8080,
 		RPCListenPort:     50050,
 		tlsConfig:         ecconet.NewTLSConfig(),
+		exitOnShutdown:    true,
+		shutdownCtx:       context.Background(),
+		rpcClientAuth:     tls.VerifyClientCertIfGiven,
 	}
 
-	// process the Run() options
+	// process the options
 	for _, o := range opts {
 		err := o(cfg)
 		if err != nil {
@@ -280,107 +846,181 @@ func Run(opts ...Option) {
 		}
 	}
 
+	// the go routines & shutdown log unconditionally, so never leave the logger nil
+	if cfg.logger == nil {
+		cfg.logger = zap.NewNop()
+	}
+
+	if err := cfg.checkOptions(); err != nil {
+		panic("setting server options -- " + err.Error())
+	}
+
+	if len(cfg.environment) > 0 {
+		cfg.logger = cfg.logger.With(zap.String(environmentLabel, cfg.environment))
+	}
+
+	return cfg
+}
+
+// checkOptions rejects the combinations of options which cannot be
+// checked as each is applied, since options may be given in any order
+func (cfg *Config) checkOptions() error {
+	if err := cfg.checkMinimal(); err != nil {
+		return err
+	}
+
+	if len(cfg.metricsRoutes) > 0 && cfg.metricsHandler == nil {
+		return errors.New("WithMetricsHandler requires WithMetricsServer")
+	}
+
+	if cfg.metricsTLS && len(cfg.metricsCertFilename) == 0 && len(cfg.CertFilename) == 0 {
+		return errors.New("WithMetricsTLS requires WithCertificate or WithMetricsCertificate")
+	}
+
+	return nil
+}
+
+// checkMinimal rejects the options which WithMinimal would make inert
+func (cfg *Config) checkMinimal() error {
+	if !cfg.minimal {
+		return nil
+	}
+
+	for _, inert := range []struct {
+		option string
+		set    bool
+	}{
+		{"WithMetricsHandler", len(cfg.metricsRoutes) > 0},
+		{"WithMetricsAuth", cfg.metricsAuth != nil},
+		{"WithMetricsRegistry", cfg.registry != nil},
+		{"WithHystrixStream", cfg.hystrixStream},
+		{"WithRequestTracing", cfg.requestRecorder != nil},
+		{"WithRuntimeMetrics", cfg.runtimeMetrics},
+		{"WithUserAgentMetrics", len(cfg.httpMetricsOptions) > 0},
+	} {
+		if inert.set {
+			return errMutuallyExclusive("WithMinimal", inert.option)
+		}
+	}
+
+	return nil
+}
+
+// Run starts the configured servers. Unless WithShutdownSignal has been
+// provided, Run blocks until the servers have been shut down and returns
+// any error encountered while shutting down.
+func Run(opts ...Option) error {
+	cfg := newConfig(opts...)
+	cfg.started = time.Now()
+
+	if cfg.Handler == nil && cfg.RPCRegister == nil && cfg.metricsHandler == nil {
+		cfg.logger.Error("no servers configured -- provide WithHTTPServer, WithRPCServer and/or WithMetricsServer")
+		return ErrNoServers
+	}
+
+	if cfg.runtimeMetrics {
+		var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+		if cfg.registry != nil {
+			registerer = cfg.registry
+		}
+
+		service := cfg.serviceName
+		if len(service) == 0 {
+			service = filepath.Base(os.Args[0])
+		}
+
+		if err := registerRuntimeCollector(registerer, service); err != nil {
+			return err
+		}
+	}
+
+	if cfg.drainer == nil {
+		cfg.drainer = gsh.NewDrainer(5 * time.Second)
+	}
+	cfg.drainer.OnDrain(cfg.drainHooks...)
+
+	// captured before the servers start, & modify, the config
+	effectiveConfig := cfg.effectiveConfig()
+
+	if err := cfg.buildServers(effectiveConfig); err != nil {
+		return err
+	}
+
 	// make a channel to listen on events,
 	// then launch the servers.
 
-	errc := make(chan eventSource)
+	// errc is buffered for every event which may be sent on it: one from
+	// the signal monitor and, for each server, one when it stops & one from
+	// its shutdown.  Once shutdown has begun, nothing reads the late
+	// events, so an unbuffered send would block forever.
+	errc := make(chan eventSource, 1+2*3)
 	var wg *sync.WaitGroup
 
+	// the signal handling is established before anything is bound, so a
+	// shutdown requested while the servers are still starting cancels
+	// startup rather than racing the server go routines
+	startup, abortStartup := context.WithCancel(context.Background())
+	defer abortStartup()
+
 	// if caller didn't pass a shutdown signal, create a go func to listen for signals
 	if cfg.wg == nil {
 		wg = &sync.WaitGroup{}
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(c)
+
+		// the monitor exits once Run returns
+		done := make(chan struct{})
+		defer close(done)
 
 		go func() {
-			errc <- eventSource{
-				source: interrupt,
-				err:    fmt.Errorf("%s", <-c),
+			var evt eventSource
+			select {
+			case sig := <-c:
+				evt = eventSource{source: interrupt, signal: sig}
+			case <-cfg.shutdownCtx.Done():
+				evt = eventSource{source: contextCancelled, err: context.Cause(cfg.shutdownCtx)}
+			case <-done:
+				return
 			}
+			abortStartup()
+			errc <- evt
 		}()
 	} else {
 		wg = cfg.wg
 		wg.Add(1)
 		go func() {
 			defer cfg.logger.Debug("signal monitor routine has exited")
-			<-cfg.shutdown
+			select {
+			case <-cfg.shutdown:
+			case <-cfg.shutdownCtx.Done():
+			}
+			abortStartup()
 			wg.Done()
 		}()
 	}
 
-	defer close(errc)
+	lis, err := cfg.bindListeners(startup)
+	if err != nil {
+		if startup.Err() != nil {
+			cfg.logger.Info("shutdown requested during startup")
+			return nil
+		}
+		return err
+	}
+	if cfg.boundAddr != nil {
+		lis.report(cfg.boundAddr)
+	}
 
 	// gRPC server
-	if cfg.RPCRegister != nil {
+	if cfg.rpcServer != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer cfg.logger.Debug("rpc go routine has exited")
 
-			rpcListenPort := ":" + strconv.Itoa(cfg.RPCListenPort)
-			lis, err := net.Listen("tcp", rpcListenPort)
-			if err != nil {
-				errc <- eventSource{
-					err:    err,
-					source: rpcServer,
-				}
-				return
-			}
-
-			// configure the RPC server
-			interceptors := []grpc.UnaryServerInterceptor{grpc_prometheus.UnaryServerInterceptor}
-
-			if cfg.logger != nil {
-				interceptors = append(interceptors,
-					gsh.RPCEndpointLog(cfg.logger, cfg.serviceName))
-			}
-			/*
-				if cfg.UseTracer {
-						interceptors = append(interceptors,
-							otgrpc.OpenTracingServerInterceptor(opentracing.GlobalTracer(),
-								otgrpc.LogPayloads()))
-				}
-			*/
-			if len(cfg.RPCUnaryInterceptorList) > 0 {
-				interceptors = append(interceptors, cfg.RPCUnaryInterceptorList...)
-			}
-			grpcMiddleware := grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(interceptors...))
-
-			if cfg.Insecure {
-				cfg.rpcServer = grpc.NewServer(
-					grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-					grpcMiddleware)
-			} else {
-				// load the necessary certificates, etc. to establish a connection
-				// secured by mutual authentication over TLS
-				cert, err := tls.LoadX509KeyPair(cfg.CertFilename, cfg.KeyFilename)
-				if err != nil {
-					panic(fmt.Sprintf("unable to load certificate (certificate file %s / key file %s) -- %s\n",
-						cfg.CertFilename, cfg.KeyFilename, err))
-				}
-				tlsConfig := ecconet.NewTLSConfig()
-				tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
-				tlsConfig.Certificates = []tls.Certificate{cert}
-
-				creds := credentials.NewTLS(tlsConfig)
-
-				cfg.rpcServer = grpc.NewServer(
-					grpc.Creds(creds),
-					grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-					grpcMiddleware)
-			}
-
-			err = cfg.RPCRegister(cfg.rpcServer)
-			if err != nil {
-				panic(fmt.Sprintf("unable to register RPC endpoint -- %s", err.Error()))
-			}
-
-			// register w. prometheus
-			grpc_prometheus.Register(cfg.rpcServer)
-			grpc_prometheus.EnableHandlingTimeHistogram()
-
 			// run the server
-			err = cfg.rpcServer.Serve(lis)
+			err := cfg.rpcServer.Serve(lis.rpc)
 			if err != nil && cfg.logger != nil {
 				cfg.logger.Debug("rpcServer has terminated with error",
 					zap.Error(err))
@@ -396,49 +1036,11 @@ func Run(opts ...Option) {
 			defer wg.Done()
 			defer cfg.logger.Debug("http go routine has exited")
 
-			rootMux := http.NewServeMux()
-
-			rootMux.Handle("/", cfg.Handler)
-
-			chain := alice.New(gsh.HTTPMetricsCollector, gsh.HTTPAccessLogger(cfg.logger))
-
-			/*
-				if cfg.UseTracer {
-						var tracer func(http.Handler) http.Handler
-
-						t, err := gsh.NewTracer(cfg.serviceName)
-						if err != nil {
-							cfg.logger.Panic("unable to construct NewTracer", zap.Error(err))
-						}
-						tracer = gsh.TracerFromHTTPRequest(t, "http")
-						chain.Append(tracer)
-				}
-			*/
-
-			if len(cfg.Hostname) > 0 {
-				canonical := handlers.CanonicalHost(cfg.Hostname, http.StatusPermanentRedirect)
-				chain = chain.Append(canonical)
-			}
-
-			if cfg.Compress {
-				chain = chain.Append(handlers.CompressHandler)
-			}
-
-			cfg.httpServer.ConnState = gsh.HTTPConnectionMetricsCollector
-
-			httpListenAddress := ":" + strconv.Itoa(cfg.HTTPListenPort)
-			cfg.httpServer.Addr = httpListenAddress
-			cfg.httpServer.Handler = chain.Then(rootMux)
-			cfg.httpServer.TLSConfig = cfg.tlsConfig
-
+			// the certificates are already in the TLS config
 			if cfg.Insecure {
-				err = cfg.httpServer.ListenAndServe()
+				err = cfg.httpServer.Serve(lis.http)
 			} else {
-				if cfg.clientAuth != tls.NoClientCert {
-					cfg.httpServer.TLSConfig.ClientAuth = cfg.clientAuth
-				}
-
-				err = cfg.httpServer.ListenAndServeTLS(cfg.CertFilename, cfg.KeyFilename)
+				err = cfg.httpServer.ServeTLS(lis.http, "", "")
 			}
 
 			if err == http.ErrServerClosed {
@@ -453,32 +1055,24 @@ func Run(opts ...Option) {
 	}
 
 	// start the metrics/hystrix/health stream provider
-	if cfg.metricsHandler != nil {
+	if cfg.metricsServer != nil {
+		// started here, rather than in the go routine, so that a
+		// shutdown is certain to see it & stop it
+		if cfg.hystrixStreamHandler != nil {
+			cfg.hystrixStreamHandler.Start()
+		}
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer cfg.logger.Debug("metrics go routine has exited")
 
-			rootMux := http.NewServeMux()
-
-			chain := alice.New(gsh.HTTPMetricsCollector, gsh.HTTPAccessLogger(cfg.logger))
-
-			hystrixStreamHandler := afex.NewStreamHandler()
-			hystrixStreamHandler.Start()
-
-			rootMux.Handle("/debug/vars", expvar.Handler())
-			rootMux.Handle("/hystrix", hystrixStreamHandler)
-			rootMux.Handle("/metrics", promhttp.Handler())
-			rootMux.Handle("/", cfg.metricsHandler)
-
-			listenPort := ":" + strconv.Itoa(cfg.MetricsListenPort)
-			cfg.metricsServer = &http.Server{
-				Addr:      listenPort,
-				Handler:   chain.Then(rootMux),
-				ConnState: gsh.HTTPConnectionMetricsCollector,
+			var err error
+			if cfg.metricsServer.TLSConfig != nil {
+				err = cfg.metricsServer.ServeTLS(lis.metrics, "", "")
+			} else {
+				err = cfg.metricsServer.Serve(lis.metrics)
 			}
-
-			err := cfg.metricsServer.ListenAndServe()
 			if err == http.ErrServerClosed {
 				err = nil
 			}
@@ -489,7 +1083,7 @@ func Run(opts ...Option) {
 		}()
 	}
 
-	cfg.logLaunch()
+	cfg.logStart(lis)
 
 	if cfg.wg != nil {
 		cfg.wg.Add(1)
@@ -498,54 +1092,482 @@ func Run(opts ...Option) {
 			defer cfg.logger.Debug("shutdown monitor go routine has exited")
 
 			// wait for somthin'
-			<-cfg.shutdown
+			var rc eventSource
+			select {
+			case <-cfg.shutdown:
+				rc = eventSource{source: shutdownChannel}
+			case <-cfg.shutdownCtx.Done():
+				rc = eventSource{source: contextCancelled, err: context.Cause(cfg.shutdownCtx)}
+			}
 
 			// somethin happened, now shut everything down gracefully, if possible
-			rc := eventSource{
-				source: unknown,
-				err:    nil,
+			cfg.logger.Debug("Initiating Graceful Shutdown", zap.Stringer("source", rc.source))
+			if err := cfg.performGracefulShutdown(errc, rc); err != nil {
+				cfg.logger.Error("graceful shutdown did not complete", zap.Error(err))
 			}
-			cfg.logger.Debug("shutdown channel closed. Initiating Graceful Shutdown")
-			cfg.performGracefulShutdown(errc, rc)
 		}()
 
-		return
+		return nil
 	}
 
 	// wait for somthin'
 	rc := <-errc
 	cfg.logger.Debug("somthin happend")
 	// somethin happened, now shut everything down gracefully, if possible
-	cfg.performGracefulShutdown(errc, rc)
-	// close(errc)
+	return cfg.performGracefulShutdown(errc, rc)
 }
 
-func (cfg *Config) logLaunch() {
-	if cfg.logger == nil {
-		return
+// buildServers builds each configured server and loads its certificates.
+// It runs before any go routine is started, so that a shutdown always finds
+// every server, and a bad certificate is returned rather than discovered
+// once the listeners are bound.
+func (cfg *Config) buildServers(effectiveConfig map[string]interface{}) error {
+	if cfg.RPCRegister != nil {
+		if err := cfg.buildRPCServer(); err != nil {
+			return err
+		}
 	}
 
-	serverList := make([]zapcore.Field, 0, 3)
+	if cfg.Handler != nil {
+		if err := cfg.buildHTTPServer(); err != nil {
+			return err
+		}
+	}
 
-	if cfg.RPCRegister != nil {
-		serverList = append(serverList, zap.Int("gRPC_port", cfg.RPCListenPort))
+	if cfg.metricsHandler != nil {
+		if err := cfg.buildMetricsServer(effectiveConfig); err != nil {
+			return err
+		}
 	}
-	if cfg.Handler != nil {
-		var key = "HTTPS_port"
+
+	return nil
+}
+
+// loadCertificate loads the certificate & key into tlsConfig, as
+// http.Server's ServeTLS would, unless tlsConfig already provides a
+// certificate and no files are given
+func loadCertificate(tlsConfig *tls.Config, certFilename, keyFilename string) error {
+	hasCert := len(tlsConfig.Certificates) > 0 || tlsConfig.GetCertificate != nil
+	if hasCert && len(certFilename) == 0 && len(keyFilename) == 0 {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFilename, keyFilename)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate (certificate file %s / key file %s) -- %w",
+			certFilename, keyFilename, err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	return nil
+}
+
+// buildRPCServer builds the gRPC server & registers its endpoints
+func (cfg *Config) buildRPCServer() error {
+	serverOptions := cfg.rpcInterceptorOptions()
+
+	if cfg.rpcCredentials != nil {
+		serverOptions = append(serverOptions, grpc.Creds(cfg.rpcCredentials))
+	} else if !cfg.Insecure {
+		// load the necessary certificates, etc. to establish a connection
+		// secured by mutual authentication over TLS
+		tlsConfig := cfg.rpcTLSConfig()
+		if err := loadCertificate(tlsConfig, cfg.CertFilename, cfg.KeyFilename); err != nil {
+			return err
+		}
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	if cfg.rpcMaxConnectionAge > 0 {
+		serverOptions = append(serverOptions, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge:      cfg.rpcMaxConnectionAge,
+			MaxConnectionAgeGrace: rpcMaxConnectionAgeGrace,
+		}))
+	}
+
+	rpcServer := grpc.NewServer(serverOptions...)
+
+	if err := cfg.RPCRegister(rpcServer); err != nil {
+		return fmt.Errorf("unable to register RPC endpoint -- %w", err)
+	}
+
+	// register w. prometheus
+	if !cfg.minimal {
+		grpc_prometheus.Register(rpcServer)
+		grpc_prometheus.EnableHandlingTimeHistogram()
+	}
+
+	cfg.rpcServer = rpcServer
+
+	return nil
+}
+
+// buildHTTPServer completes the HTTP server created by WithHTTPServer
+// or WithPublicEndpoint
+func (cfg *Config) buildHTTPServer() error {
+	rootMux := http.NewServeMux()
+
+	rootMux.Handle("/", cfg.Handler)
+
+	chainOptions := []gsh.ChainOption{
+		gsh.WithAccessLogOptions(cfg.accessLogOptions...),
+		gsh.WithDrainer(cfg.drainer),
+	}
+	if len(cfg.Hostname) > 0 {
+		chainOptions = append(chainOptions, gsh.WithCanonicalHost(cfg.Hostname))
+	}
+	if cfg.requireHTTPS != nil {
+		chainOptions = append(chainOptions, cfg.requireHTTPS)
+	}
+	if cfg.gzipOptions != nil {
+		chainOptions = append(chainOptions, cfg.gzipOptions)
+	} else if cfg.Compress {
+		chainOptions = append(chainOptions, gsh.WithCompression())
+	}
+	if cfg.clientCertUser {
+		chainOptions = append(chainOptions, gsh.WithClientCertUser(cfg.clientCertOptions...))
+	}
+	if cfg.minimal {
+		chainOptions = append(chainOptions, gsh.WithoutMetrics())
+	} else if len(cfg.httpMetricsOptions) > 0 {
+		chainOptions = append(chainOptions, gsh.WithMetricsOptions(cfg.httpMetricsOptions...))
+	}
+	chain := gsh.DefaultChain(cfg.logger, chainOptions...)
+
+	/*
+		if cfg.UseTracer {
+				var tracer func(http.Handler) http.Handler
+
+				t, err := gsh.NewTracer(cfg.serviceName)
+				if err != nil {
+					cfg.logger.Panic("unable to construct NewTracer", zap.Error(err))
+				}
+				tracer = gsh.TracerFromHTTPRequest(t, "http")
+				chain.Append(tracer)
+		}
+	*/
+
+	if !cfg.minimal {
+		cfg.httpServer.ConnState = gsh.HTTPConnectionMetricsCollector
+	}
+	if cfg.httpServer.ReadHeaderTimeout == 0 {
+		cfg.httpServer.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	cfg.httpTimeouts.apply(cfg.httpServer)
+	if cfg.maxHeaderBytes > 0 {
+		cfg.httpServer.MaxHeaderBytes = cfg.maxHeaderBytes
+	}
+
+	httpListenAddress := ":" + strconv.Itoa(cfg.HTTPListenPort)
+	cfg.httpServer.Addr = httpListenAddress
+	cfg.httpServer.Handler = chain.Then(rootMux)
+	cfg.httpServer.TLSConfig = cfg.tlsConfig
+
+	if cfg.Insecure {
+		return nil
+	}
+
+	// a copy, so that the certificates are not added to a caller's WithTLSConfig
+	tlsConfig := cfg.tlsConfig.Clone()
+	if cfg.clientAuth != tls.NoClientCert {
+		tlsConfig.ClientAuth = cfg.clientAuth
+	}
+	cfg.httpServer.TLSConfig = tlsConfig
+
+	if len(cfg.sniCertificates) > 0 {
+		sni, err := newSNICertificates(cfg.logger,
+			CertKeyPair{CertFilename: cfg.CertFilename, KeyFilename: cfg.KeyFilename}, cfg.sniCertificates)
+		if err != nil {
+			return err
+		}
+		tlsConfig.GetCertificate = sni.GetCertificate
+
+		return nil
+	}
+
+	return loadCertificate(tlsConfig, cfg.CertFilename, cfg.KeyFilename)
+}
+
+// buildMetricsServer builds the server of the metrics, debug, hystrix
+// stream & health endpoints
+func (cfg *Config) buildMetricsServer(effectiveConfig map[string]interface{}) error {
+	if cfg.hystrixStream {
+		cfg.hystrixStreamHandler = afex.NewStreamHandler()
+	}
+
+	if cfg.minimal {
+		// only the health checks, without metrics
+		return cfg.newMetricsServer(gsh.HTTPAccessLogger(cfg.logger)(cfg.metricsHandler), nil)
+	}
+
+	rootMux := http.NewServeMux()
+
+	chain := alice.New(gsh.HTTPMetricsCollector, gsh.HTTPAccessLogger(cfg.logger))
+
+	// every route but the health checks, at "/", requires WithMetricsAuth
+	protect := func(h http.Handler) http.Handler { return h }
+	if cfg.metricsAuth != nil {
+		protect = authorize(cfg.metricsAuth)
+	}
+
+	if cfg.hystrixStreamHandler != nil {
+		// CORS answers a permitted origin's preflight, which carries no
+		// credentials, ahead of the auth check, and lets the dashboard read
+		// a 401, too
+		stream := protect(gsh.NoStore()(cfg.hystrixStreamHandler))
+		if len(cfg.hystrixStreamOrigins) > 0 {
+			stream = gsh.CORS(cfg.hystrixStreamOrigins...)(stream)
+		}
+		rootMux.Handle("/hystrix", stream)
+	}
+
+	rootMux.Handle("/debug/vars", protect(expvar.Handler()))
+	rootMux.Handle(debugConfigPath, protect(debugConfigHandler(effectiveConfig)))
+	if cfg.requestRecorder != nil {
+		rootMux.Handle("/debug/requests", protect(cfg.requestRecorder))
+	}
+	for path, h := range cfg.metricsRoutes {
+		rootMux.Handle(path, protect(h))
+	}
+	metrics := promhttp.Handler()
+	if len(cfg.environment) > 0 || cfg.registry != nil {
+		var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+		if cfg.registry != nil {
+			gatherer = prometheus.Gatherers{gatherer, cfg.registry}
+		}
+		if len(cfg.environment) > 0 {
+			gatherer = newLabelingGatherer(gatherer, environmentLabel, cfg.environment)
+		}
+		metrics = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	}
+	rootMux.Handle("/metrics", protect(metrics))
+	rootMux.Handle("/", cfg.metricsHandler)
+
+	return cfg.newMetricsServer(chain.Then(rootMux), gsh.HTTPConnectionMetricsCollector)
+}
+
+// newMetricsServer sets cfg.metricsServer to a server of h, with the
+// certificates of WithMetricsTLS
+func (cfg *Config) newMetricsServer(h http.Handler, connState func(net.Conn, http.ConnState)) error {
+	listenPort := ":" + strconv.Itoa(cfg.MetricsListenPort)
+	metricsServer := &http.Server{
+		Addr:              listenPort,
+		Handler:           h,
+		ConnState:         connState,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		MaxHeaderBytes:    cfg.maxHeaderBytes,
+	}
+
+	if cfg.metricsTLS {
+		certFilename, keyFilename := cfg.CertFilename, cfg.KeyFilename
+		if len(cfg.metricsCertFilename) > 0 {
+			certFilename, keyFilename = cfg.metricsCertFilename, cfg.metricsKeyFilename
+		}
+
+		metricsServer.TLSConfig = ecconet.NewTLSConfig()
+		metricsServer.TLSConfig.ClientAuth = cfg.metricsClientAuth
+		if err := loadCertificate(metricsServer.TLSConfig, certFilename, keyFilename); err != nil {
+			return err
+		}
+	}
+
+	cfg.metricsServer = metricsServer
+
+	return nil
+}
+
+// rpcTLSConfig returns the TLS configuration of the gRPC server,
+// without its certificate
+func (cfg *Config) rpcTLSConfig() *tls.Config {
+	tlsConfig := ecconet.NewTLSConfig()
+	tlsConfig.ClientAuth = cfg.rpcClientAuth
+
+	return tlsConfig
+}
+
+// rpcInterceptorOptions returns the gRPC server options
+// which install the logging, metrics & caller-provided interceptors
+func (cfg *Config) rpcInterceptorOptions() []grpc.ServerOption {
+	var interceptors []grpc.UnaryServerInterceptor
+	var options []grpc.ServerOption
+
+	if !cfg.minimal {
+		interceptors = append(interceptors, grpc_prometheus.UnaryServerInterceptor)
+		options = append(options, grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor))
+	}
+
+	if cfg.logger != nil {
+		interceptors = append(interceptors,
+			gsh.RPCEndpointLog(cfg.logger, cfg.serviceName, cfg.accessLogOptions...))
+	}
+	/*
+		if cfg.UseTracer {
+				interceptors = append(interceptors,
+					otgrpc.OpenTracingServerInterceptor(opentracing.GlobalTracer(),
+						otgrpc.LogPayloads()))
+		}
+	*/
+	if len(cfg.RPCUnaryInterceptorList) > 0 {
+		interceptors = append(interceptors, cfg.RPCUnaryInterceptorList...)
+	}
+
+	return append(options, grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(interceptors...)))
+}
+
+// authorize returns middleware which rejects requests for which fn returns false
+func authorize(fn func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fn(r) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// listen creates a TCP listener on the given port using the configured net.ListenConfig
+func (cfg *Config) listen(ctx context.Context, port int) (net.Listener, error) {
+	return cfg.listenConfig.Listen(ctx, "tcp", ":"+strconv.Itoa(port))
+}
+
+// listeners holds the bound listeners of the configured servers
+type listeners struct {
+	rpc     net.Listener
+	http    net.Listener
+	metrics net.Listener
+}
+
+// report calls fn with the address of each bound listener
+func (l *listeners) report(fn func(kind ServerKind, addr net.Addr)) {
+	for kind, lis := range []net.Listener{KindHTTP: l.http, KindRPC: l.rpc, KindMetrics: l.metrics} {
+		if lis != nil {
+			fn(ServerKind(kind), lis.Addr())
+		}
+	}
+}
+
+func (l *listeners) close() {
+	for _, lis := range []net.Listener{l.rpc, l.http, l.metrics} {
+		if lis != nil {
+			lis.Close()
+		}
+	}
+}
+
+// bindListeners binds a listener for each configured server. If ctx is
+// cancelled or any bind fails, the listeners bound so far are closed so
+// that nothing is left half-started.
+func (cfg *Config) bindListeners(ctx context.Context) (*listeners, error) {
+	l := &listeners{}
+
+	bind := func(enabled bool, port int, dst *net.Listener) error {
+		if !enabled {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		lis, err := cfg.listen(ctx, port)
+		if err != nil {
+			return err
+		}
+		*dst = lis
+
+		return nil
+	}
+
+	err := bind(cfg.RPCRegister != nil, cfg.RPCListenPort, &l.rpc)
+	if err == nil {
+		err = bind(cfg.Handler != nil, cfg.HTTPListenPort, &l.http)
+	}
+	if err == nil {
+		err = bind(cfg.metricsHandler != nil, cfg.MetricsListenPort, &l.metrics)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+
+	if cfg.maxConnections > 0 {
+		if l.rpc != nil {
+			l.rpc = ecconet.LimitListener(l.rpc, cfg.maxConnections)
+		}
+		if l.http != nil {
+			l.http = ecconet.LimitListener(l.http, cfg.maxConnections)
+		}
+	}
+
+	return l, nil
+}
+
+// serviceFields returns the service-level fields included in the lifecycle events
+func (cfg *Config) serviceFields() []zapcore.Field {
+	fields := []zapcore.Field{zap.String("version", version.VERSION)}
+	if len(cfg.serviceName) > 0 {
+		fields = append(fields, zap.String("service", cfg.serviceName))
+	}
+
+	return fields
+}
+
+// logStart emits the lifecycle event marking the servers as ready
+func (cfg *Config) logStart(lis *listeners) {
+	fields := cfg.serviceFields()
+
+	if lis.rpc != nil {
+		fields = append(fields, zap.String("gRPC_address", lis.rpc.Addr().String()))
+	}
+	if lis.http != nil {
+		var key = "HTTPS_address"
 		if cfg.Insecure {
-			key = "HTTP_port"
+			key = "HTTP_address"
 		}
-		serverList = append(serverList, zap.Int(key, cfg.HTTPListenPort))
+		fields = append(fields, zap.String(key, lis.http.Addr().String()))
 	}
-	if cfg.metricsHandler != nil {
-		serverList = append(serverList, zap.Int("metrics_port", cfg.MetricsListenPort))
+	if lis.metrics != nil {
+		var key = "metrics_address"
+		if cfg.metricsTLS {
+			key = "metrics_TLS_address"
+		}
+		fields = append(fields, zap.String(key, lis.metrics.Addr().String()))
 	}
 
+	fields = append(fields,
+		zap.Bool("tls", !cfg.Insecure),
+		zap.Duration("timeToReady", time.Since(cfg.started)))
+
 	if cfg.Insecure {
-		cfg.logger.Info("Server listening insecurely on one or more ports", serverList...)
+		cfg.logger.Info("server started; listening insecurely on one or more ports", fields...)
 	} else {
-		cfg.logger.Info("Server", serverList...)
+		cfg.logger.Info("server started", fields...)
+	}
+}
+
+// logStop emits the lifecycle event marking the end of the servers
+func (cfg *Config) logStop(evtSrc eventSource, err error) {
+	fields := cfg.serviceFields()
+	fields = append(fields,
+		zap.Duration("uptime", time.Since(cfg.started)),
+		zap.String("reason", evtSrc.source.String()))
+	if evtSrc.signal != nil {
+		fields = append(fields, zap.Stringer("signal", evtSrc.signal))
 	}
+	if evtSrc.err != nil {
+		fields = append(fields, zap.NamedError("cause", evtSrc.err))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	cfg.logger.Info("server stopped", fields...)
 }
 
 // OptionsFactory is a convenience function to build a slice of Options for the variadic Run() method
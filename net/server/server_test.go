@@ -0,0 +1,672 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// freePort returns a TCP port which was available at the time of the call
+func freePort(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer lis.Close()
+
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// waitForListener waits for a server to begin accepting connections on port
+func waitForListener(t *testing.T, port int) {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("server never started listening on %s", addr)
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	port := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	// with a long ReadTimeout, only the ReadHeaderTimeout can cut the client off
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.NotFoundHandler()),
+		WithHTTPListenPort(port),
+		WithHTTPTimeouts(time.Minute, 0, 0),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	waitForListener(t, port)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// dribble the request headers, one byte at a time
+	go func() {
+		for _, b := range []byte("GET / HTTP/1.1\r\nHost: localhost\r\nX-Slow: aaaaaaaaaaaaaaaaaaaa\r\n") {
+			if _, err := conn.Write([]byte{b}); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	_ = conn.SetReadDeadline(start.Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	// the close may arrive as a reset, as the server discards unread headers
+	var netErr net.Error
+	assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "server should have closed the connection")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestMaxConnections(t *testing.T) {
+	port := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithHTTPListenPort(port),
+		WithMaxConnections(1),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	waitForListener(t, port)
+
+	// get sends a request on a new keep-alive connection, returning the
+	// connection & a channel which receives the response's status line
+	get := func() (net.Conn, chan string) {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		assert.NoError(t, err)
+
+		status := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			status <- line
+		}()
+		return conn, status
+	}
+
+	first, firstStatus := get()
+	defer first.Close()
+	select {
+	case line := <-firstStatus:
+		assert.Contains(t, line, "200 OK")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the first connection was not served")
+	}
+
+	// the first connection, kept alive, holds the only slot...
+	second, secondStatus := get()
+	defer second.Close()
+	select {
+	case line := <-secondStatus:
+		t.Fatalf("the second connection was served beyond the limit: %q", line)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// ...until it closes
+	first.Close()
+	select {
+	case line := <-secondStatus:
+		assert.Contains(t, line, "200 OK")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the second connection was not served once the first closed")
+	}
+}
+
+func TestRunWithoutLogger(t *testing.T) {
+	port := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	assert.NotPanics(t, func() {
+		err := Run(
+			WithHTTPServer(http.NotFoundHandler()),
+			WithHTTPListenPort(port),
+			WithShutdownSignal(stop, wg),
+			WithExitOnShutdown(false),
+		)
+		assert.NoError(t, err)
+
+		waitForListener(t, port)
+
+		close(stop)
+		wg.Wait()
+	})
+}
+
+func TestShutdownContext(t *testing.T) {
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		waitForListener(t, port)
+		cancel()
+	}()
+
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.NotFoundHandler()),
+		WithHTTPListenPort(port),
+		WithShutdownContext(ctx),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+}
+
+func TestShutdownWaitGroupIsBalanced(t *testing.T) {
+	httpPort, metricsPort, rpcPort := freePort(t), freePort(t), freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.NotFoundHandler()),
+		WithHTTPListenPort(httpPort),
+		WithMetricsServer(http.NotFoundHandler()),
+		WithMetricsListenPort(metricsPort),
+		WithRPCServer(func(g *grpc.Server) error { return nil }),
+		WithRPCListenPort(rpcPort),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+
+	waitForListener(t, httpPort)
+	waitForListener(t, metricsPort)
+	waitForListener(t, rpcPort)
+
+	// a counter decremented too often panics in Done, in the server's
+	// go routines, or returns from Wait before the servers have stopped
+	waited := make(chan interface{}, 1)
+	go func() {
+		defer func() { waited <- recover() }()
+		close(stop)
+		wg.Wait()
+	}()
+
+	select {
+	case p := <-waited:
+		assert.Nil(t, p)
+	case <-time.After(10 * time.Second):
+		t.Fatal("wg.Wait did not return")
+	}
+
+	for _, port := range []int{httpPort, metricsPort, rpcPort} {
+		_, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		assert.Error(t, err, "port %d should be closed once wg.Wait returns", port)
+	}
+
+	assert.Eventually(t, func() bool {
+		return !goroutineRunning("net/server.Run") && !goroutineRunning("net/server.(*Config).performGracefulShutdown")
+	}, time.Second, 10*time.Millisecond, "the server go routines should have exited")
+}
+
+func TestBoundAddr(t *testing.T) {
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	bound := make(map[ServerKind]net.Addr)
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithHTTPListenPort(0),
+		WithMetricsServer(http.NotFoundHandler()),
+		WithMetricsListenPort(0),
+		WithRPCServer(func(g *grpc.Server) error { return nil }),
+		WithRPCListenPort(0),
+		WithBoundAddr(func(kind ServerKind, addr net.Addr) { bound[kind] = addr }),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	if !assert.Len(t, bound, 3) {
+		return
+	}
+	for kind, addr := range bound {
+		assert.NotZero(t, addr.(*net.TCPAddr).Port, "%s should have an ephemeral port", kind)
+	}
+
+	resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(bound[KindHTTP].(*net.TCPAddr).Port)) + "/")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp, err = http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(bound[KindMetrics].(*net.TCPAddr).Port)) + "/metrics")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	waitForListener(t, bound[KindRPC].(*net.TCPAddr).Port)
+}
+
+func TestRunWithNoServers(t *testing.T) {
+	err := Run(WithLogger(zap.NewNop()), WithExitOnShutdown(false))
+	assert.ErrorIs(t, err, ErrNoServers)
+}
+
+func TestSimultaneousServerErrors(t *testing.T) {
+	// neither server can load its certificate, so both fail at once,
+	// before anything is bound or any server go routine is started
+	httpPort, metricsPort := freePort(t), freePort(t)
+	done := make(chan error)
+	go func() {
+		done <- Run(
+			WithLogger(zap.NewNop()),
+			WithHTTPServer(http.NotFoundHandler()),
+			WithHTTPListenPort(httpPort),
+			WithCertificate("missing.crt", "missing.key"),
+			WithMetricsServer(http.NotFoundHandler()),
+			WithMetricsListenPort(metricsPort),
+			WithMetricsTLS(),
+			WithExitOnShutdown(false),
+		)
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.ErrorContains(t, err, "missing.crt")
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+
+	for _, port := range []int{httpPort, metricsPort} {
+		lis, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+		if assert.NoError(t, err, "port %d should not have been bound", port) {
+			lis.Close()
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return !goroutineRunning("net/server.Run") && !goroutineRunning("net/server.(*Config).performGracefulShutdown")
+	}, time.Second, 10*time.Millisecond, "the server go routines should have exited")
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, registerRuntimeCollector(reg, "test"))
+	assert.NoError(t, registerRuntimeCollector(reg, "test"), "a second server should share the collector")
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+		assert.Equal(t, "service", family.GetMetric()[0].GetLabel()[0].GetName())
+		assert.Equal(t, "test", family.GetMetric()[0].GetLabel()[0].GetValue())
+	}
+	assert.True(t, names["runtime_goroutines"])
+	assert.True(t, names["runtime_gc_pause_seconds"])
+	assert.True(t, names["runtime_heap_alloc_bytes"])
+}
+
+func TestHystrixStreamStoppedOnShutdown(t *testing.T) {
+	// the loop go routine is identified by its creator, which is reported
+	// whether or not it has been scheduled yet
+	const streamLoop = "created by github.com/afex/hystrix-go/hystrix.(*StreamHandler).Start"
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	port := freePort(t)
+
+	err := Run(
+		WithMetricsServer(http.NotFoundHandler()),
+		WithMetricsListenPort(port),
+		WithHystrixStream(),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, goroutineRunning(streamLoop), "the hystrix stream should have been started")
+
+	// wait for the metrics server to be serving, so that shutdown stops it
+	waitForListener(t, port)
+	if resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/metrics"); assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	close(stop)
+	wg.Wait()
+
+	assert.Eventually(t, func() bool { return !goroutineRunning(streamLoop) },
+		time.Second, 10*time.Millisecond, "the hystrix stream should have been stopped")
+}
+
+// goroutineRunning reports whether any goroutine stack mentions fn
+func goroutineRunning(fn string) bool {
+	buf := make([]byte, 1<<20)
+	return strings.Contains(string(buf[:runtime.Stack(buf, true)]), fn)
+}
+
+func TestMinimal(t *testing.T) {
+	httpPort, metricsPort := freePort(t), freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithMinimal(),
+		WithHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithHTTPListenPort(httpPort),
+		WithMetricsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("healthy"))
+		})),
+		WithMetricsListenPort(metricsPort),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	waitForListener(t, httpPort)
+	resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(httpPort)) + "/")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// the health checks remain, but nothing else is on the metrics port
+	waitForListener(t, metricsPort)
+	for _, path := range []string{"/healthz/ready", "/metrics", "/debug/vars"} {
+		resp, err = http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(metricsPort)) + path)
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, "healthy", string(body), path)
+		}
+	}
+
+	assert.PanicsWithValue(t, "setting server options -- WithMinimal and WithHystrixStream are mutually exclusive",
+		func() { newConfig(WithHystrixStream(), WithMinimal()) })
+	assert.PanicsWithValue(t, "setting server options -- WithMinimal and WithMetricsHandler are mutually exclusive",
+		func() { newConfig(WithMinimal(), WithMetricsHandler("/debug/cache", http.NotFoundHandler())) })
+
+	assert.Len(t, newConfig(WithMinimal()).rpcInterceptorOptions(), 1, "only the unary interceptor chain")
+	assert.Len(t, newConfig().rpcInterceptorOptions(), 2)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metricsPort := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	err := Run(
+		WithLogger(zap.NewNop()),
+		WithMetricsServer(http.NotFoundHandler()),
+		WithMetricsListenPort(metricsPort),
+		WithMetricsHandler("/debug/cache", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("cache"))
+		})),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	waitForListener(t, metricsPort)
+	resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(metricsPort)) + "/debug/cache")
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "cache", string(body))
+	}
+
+	cfg := &Config{}
+	assert.Error(t, WithMetricsHandler("/metrics", http.NotFoundHandler())(cfg))
+	assert.Error(t, WithMetricsHandler("debug/cache", http.NotFoundHandler())(cfg))
+	assert.NoError(t, WithMetricsHandler("/debug/cache", http.NotFoundHandler())(cfg))
+	assert.Error(t, WithMetricsHandler("/debug/cache", http.NotFoundHandler())(cfg))
+	assert.Error(t, WithMetricsHandler("/x/{a}/{a}", http.NotFoundHandler())(cfg))
+	assert.Error(t, WithMetricsHandler("/x{", http.NotFoundHandler())(cfg))
+	assert.NoError(t, WithMetricsHandler("/orders/{id}", http.NotFoundHandler())(cfg))
+	assert.Error(t, WithMetricsHandler("/{a}/history", http.NotFoundHandler())(cfg), "conflicts with /orders/{id}")
+
+	assert.PanicsWithValue(t, "setting server options -- WithMetricsHandler requires WithMetricsServer",
+		func() { newConfig(WithMetricsHandler("/debug/cache", http.NotFoundHandler())) })
+}
+
+func TestDebugConfig(t *testing.T) {
+	metricsPort := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(io.Discard), zap.WarnLevel))
+	err := Run(
+		WithLogger(logger),
+		WithMetricsServer(http.NotFoundHandler()),
+		WithMetricsListenPort(metricsPort),
+		WithCertificate("server.crt", "secret.key"),
+		WithSNICertificates(map[string]CertKeyPair{"api.example.com": {CertFilename: "api.crt", KeyFilename: "api.key"}}),
+		WithHTTPTimeouts(5*time.Second, 0, 0),
+		WithGzip(),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	waitForListener(t, metricsPort)
+	resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(metricsPort)) + debugConfigPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), ".key", "key filenames should be redacted")
+
+	var config map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &config))
+	assert.Equal(t, float64(metricsPort), config["metricsPort"])
+	assert.Equal(t, "server.crt", config["cert"])
+	assert.Equal(t, redacted, config["key"])
+	assert.Equal(t, map[string]interface{}{"api.example.com": map[string]interface{}{"cert": "api.crt", "key": redacted}}, config["sniCertificates"])
+	assert.Equal(t, "5s", config["httpReadTimeout"])
+	assert.Equal(t, true, config["gzip"])
+	assert.Equal(t, true, config["tls"])
+	assert.Equal(t, "warn", config["logLevel"])
+	assert.NotContains(t, config, "minimal", "empty values are omitted")
+
+	assert.Error(t, WithMetricsHandler(debugConfigPath, http.NotFoundHandler())(newConfig()))
+}
+
+func TestMutuallyExclusiveOptions(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithTLSConfig(&tls.Config{}), WithPublicEndpoint()},
+		{WithPublicEndpoint(), WithTLSConfig(&tls.Config{})},
+	} {
+		assert.PanicsWithValue(t, "setting server options -- WithTLSConfig and WithPublicEndpoint are mutually exclusive",
+			func() { newConfig(opts...) })
+	}
+
+	for _, opts := range [][]Option{
+		{WithCertificate("server.crt", "server.key"), WithRPCCredentials(insecure.NewCredentials())},
+		{WithRPCCredentials(insecure.NewCredentials()), WithCertificate("server.crt", "server.key")},
+	} {
+		assert.PanicsWithValue(t, "setting server options -- WithCertificate and WithRPCCredentials are mutually exclusive",
+			func() { newConfig(opts...) })
+	}
+
+	assert.NotPanics(t, func() { newConfig(WithPublicEndpoint(), WithCertificate("server.crt", "server.key")) })
+}
+
+func TestRPCClientAuthIsIndependentOfHTTP(t *testing.T) {
+	cfg := newConfig(WithRequestClientCert())
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.rpcTLSConfig().ClientAuth)
+
+	cfg = newConfig(WithRequestClientCert(), WithRPCRequireClientCert())
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.rpcTLSConfig().ClientAuth)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.clientAuth)
+}
+
+func TestMetricsAuthLeavesHealthChecksOpen(t *testing.T) {
+	cfg := newConfig(
+		WithMetricsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithMetricsHandler("/debug/cache", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithMetricsAuth(BearerTokenAuth("secret")),
+	)
+	if !assert.NoError(t, cfg.buildMetricsServer(cfg.effectiveConfig())) {
+		t.FailNow()
+	}
+
+	get := func(path, token string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(token) > 0 {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		cfg.metricsServer.Handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	for _, path := range []string{"/healthz/live", "/healthz/ready"} {
+		assert.Equal(t, http.StatusOK, get(path, ""), path)
+	}
+	for _, path := range []string{"/metrics", "/debug/vars", debugConfigPath, "/debug/cache"} {
+		assert.Equal(t, http.StatusUnauthorized, get(path, ""), path)
+		assert.Equal(t, http.StatusUnauthorized, get(path, "wrong"), path)
+		assert.Equal(t, http.StatusOK, get(path, "secret"), path)
+	}
+}
+
+func TestMetricsAuthPermitsHystrixPreflight(t *testing.T) {
+	const dashboard = "https://ops.example.com"
+	cfg := newConfig(
+		WithMetricsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		WithMetricsAuth(BearerTokenAuth("secret")),
+		WithHystrixStreamOrigins(dashboard),
+	)
+	if !assert.NoError(t, cfg.buildMetricsServer(cfg.effectiveConfig())) {
+		t.FailNow()
+	}
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/hystrix", nil)
+		r.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			r.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		rr := httptest.NewRecorder()
+		cfg.metricsServer.Handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// the browser's preflight carries no credentials
+	rr := request(http.MethodOptions, dashboard)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, dashboard, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+
+	// the stream still requires them, & the dashboard can read the 401
+	rr = request(http.MethodGet, dashboard)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, dashboard, rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// other origins get no preflight response
+	rr = request(http.MethodOptions, "https://evil.example.com")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestMetricsTLSRequiresCertificate(t *testing.T) {
+	assert.PanicsWithValue(t, "setting server options -- WithMetricsTLS requires WithCertificate or WithMetricsCertificate",
+		func() { newConfig(WithMetricsServer(http.NotFoundHandler()), WithMetricsTLS()) })
+	assert.NotPanics(t, func() { newConfig(WithMetricsTLS(), WithCertificate("server.crt", "server.key")) })
+	assert.NotPanics(t, func() { newConfig(WithMetricsCertificate("metrics.crt", "metrics.key")) })
+}
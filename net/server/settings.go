@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Settings is the serializable counterpart of the Options, for services
+// which load their server configuration from a file, e.g., with viper:
+//
+//	var s server.Settings
+//	if err := viper.UnmarshalKey("server", &s); err != nil { ... }
+//	err := server.RunWithSettings(s, server.WithHTTPServer(h), server.WithLogger(logger))
+//
+// Zero values leave the corresponding default unchanged.  Handlers,
+// loggers & other values which cannot be serialized remain Options.
+//
+// The effective Settings are served at /debug/config on the metrics
+// server, except the values of the fields tagged `redact:"true"`.
+type Settings struct {
+	HTTPListenPort    int `mapstructure:"httpPort" json:"httpPort,omitempty" yaml:"httpPort,omitempty"`
+	RPCListenPort     int `mapstructure:"rpcPort" json:"rpcPort,omitempty" yaml:"rpcPort,omitempty"`
+	MetricsListenPort int `mapstructure:"metricsPort" json:"metricsPort,omitempty" yaml:"metricsPort,omitempty"`
+
+	// TLS
+	CertFilename         string `mapstructure:"cert" json:"cert,omitempty" yaml:"cert,omitempty"`
+	KeyFilename          string `mapstructure:"key" json:"key,omitempty" yaml:"key,omitempty" redact:"true"`
+	RequestClientCert    bool   `mapstructure:"requestClientCert" json:"requestClientCert,omitempty" yaml:"requestClientCert,omitempty"`
+	RPCRequireClientCert bool   `mapstructure:"rpcRequireClientCert" json:"rpcRequireClientCert,omitempty" yaml:"rpcRequireClientCert,omitempty"`
+	PublicEndpoint       bool   `mapstructure:"publicEndpoint" json:"publicEndpoint,omitempty" yaml:"publicEndpoint,omitempty"`
+	MetricsTLS           bool   `mapstructure:"metricsTLS" json:"metricsTLS,omitempty" yaml:"metricsTLS,omitempty"`
+	MetricsCertFilename  string `mapstructure:"metricsCert" json:"metricsCert,omitempty" yaml:"metricsCert,omitempty"`
+	MetricsKeyFilename   string `mapstructure:"metricsKey" json:"metricsKey,omitempty" yaml:"metricsKey,omitempty" redact:"true"`
+
+	SNICertificates map[string]CertKeyPair `mapstructure:"sniCertificates" json:"sniCertificates,omitempty" yaml:"sniCertificates,omitempty"`
+
+	// timeouts & limits
+	HTTPReadTimeout     time.Duration `mapstructure:"httpReadTimeout" json:"httpReadTimeout,omitempty" yaml:"httpReadTimeout,omitempty"`
+	HTTPWriteTimeout    time.Duration `mapstructure:"httpWriteTimeout" json:"httpWriteTimeout,omitempty" yaml:"httpWriteTimeout,omitempty"`
+	HTTPIdleTimeout     time.Duration `mapstructure:"httpIdleTimeout" json:"httpIdleTimeout,omitempty" yaml:"httpIdleTimeout,omitempty"`
+	RPCMaxConnectionAge time.Duration `mapstructure:"rpcMaxConnectionAge" json:"rpcMaxConnectionAge,omitempty" yaml:"rpcMaxConnectionAge,omitempty"`
+	MaxConnections      int           `mapstructure:"maxConnections" json:"maxConnections,omitempty" yaml:"maxConnections,omitempty"`
+	MaxHeaderBytes      int           `mapstructure:"maxHeaderBytes" json:"maxHeaderBytes,omitempty" yaml:"maxHeaderBytes,omitempty"`
+
+	// flags
+	CanonicalHost        string   `mapstructure:"canonicalHost" json:"canonicalHost,omitempty" yaml:"canonicalHost,omitempty"`
+	Gzip                 bool     `mapstructure:"gzip" json:"gzip,omitempty" yaml:"gzip,omitempty"`
+	ServerTiming         bool     `mapstructure:"serverTiming" json:"serverTiming,omitempty" yaml:"serverTiming,omitempty"`
+	RedactedMetadata     []string `mapstructure:"redactedMetadata" json:"redactedMetadata,omitempty" yaml:"redactedMetadata,omitempty"`
+	HystrixStream        bool     `mapstructure:"hystrixStream" json:"hystrixStream,omitempty" yaml:"hystrixStream,omitempty"`
+	HystrixStreamOrigins []string `mapstructure:"hystrixStreamOrigins" json:"hystrixStreamOrigins,omitempty" yaml:"hystrixStreamOrigins,omitempty"`
+	RuntimeMetrics       bool     `mapstructure:"runtimeMetrics" json:"runtimeMetrics,omitempty" yaml:"runtimeMetrics,omitempty"`
+	Minimal              bool     `mapstructure:"minimal" json:"minimal,omitempty" yaml:"minimal,omitempty"`
+	Tracer               bool     `mapstructure:"tracer" json:"tracer,omitempty" yaml:"tracer,omitempty"`
+	ServiceName          string   `mapstructure:"serviceName" json:"serviceName,omitempty" yaml:"serviceName,omitempty"`
+	Environment          string   `mapstructure:"environment" json:"environment,omitempty" yaml:"environment,omitempty"`
+}
+
+// Validate checks the whole of s at once, returning every problem found
+func (s Settings) Validate() error {
+	var errs []error
+
+	for name, port := range map[string]int{
+		"httpPort":    s.HTTPListenPort,
+		"rpcPort":     s.RPCListenPort,
+		"metricsPort": s.MetricsListenPort,
+	} {
+		if port < 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s %d is not a valid port", name, port))
+		}
+	}
+
+	if (len(s.CertFilename) == 0) != (len(s.KeyFilename) == 0) {
+		errs = append(errs, errors.New("cert and key must be provided together"))
+	}
+	if (len(s.MetricsCertFilename) == 0) != (len(s.MetricsKeyFilename) == 0) {
+		errs = append(errs, errors.New("metricsCert and metricsKey must be provided together"))
+	}
+	if s.MetricsTLS && len(s.CertFilename) == 0 && len(s.MetricsCertFilename) == 0 {
+		errs = append(errs, errors.New("metricsTLS requires a cert or metricsCert"))
+	}
+	if s.RequestClientCert && len(s.CertFilename) == 0 {
+		errs = append(errs, errors.New("requestClientCert requires a cert"))
+	}
+	if s.RPCRequireClientCert && len(s.CertFilename) == 0 {
+		errs = append(errs, errors.New("rpcRequireClientCert requires a cert"))
+	}
+	if len(s.SNICertificates) > 0 && len(s.CertFilename) == 0 {
+		errs = append(errs, errors.New("sniCertificates requires a (default) cert"))
+	}
+	for name, pair := range s.SNICertificates {
+		if len(pair.CertFilename) == 0 || len(pair.KeyFilename) == 0 {
+			errs = append(errs, fmt.Errorf("sniCertificates %s requires a cert and key", name))
+		}
+	}
+
+	for name, d := range map[string]time.Duration{
+		"httpReadTimeout":     s.HTTPReadTimeout,
+		"httpWriteTimeout":    s.HTTPWriteTimeout,
+		"httpIdleTimeout":     s.HTTPIdleTimeout,
+		"rpcMaxConnectionAge": s.RPCMaxConnectionAge,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s may not be negative", name))
+		}
+	}
+	if s.Minimal {
+		for name, set := range map[string]bool{
+			"hystrixStream":  s.HystrixStream,
+			"runtimeMetrics": s.RuntimeMetrics,
+		} {
+			if set {
+				errs = append(errs, fmt.Errorf("minimal and %s are mutually exclusive", name))
+			}
+		}
+	}
+	if s.MaxConnections < 0 {
+		errs = append(errs, errors.New("maxConnections may not be negative"))
+	}
+	if s.MaxHeaderBytes < 0 {
+		errs = append(errs, errors.New("maxHeaderBytes may not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Options returns the Options equivalent to s
+func (s Settings) Options() []Option {
+	opts := make([]Option, 0)
+
+	if s.HTTPListenPort != 0 {
+		opts = append(opts, WithHTTPListenPort(s.HTTPListenPort))
+	}
+	if s.RPCListenPort != 0 {
+		opts = append(opts, WithRPCListenPort(s.RPCListenPort))
+	}
+	if s.MetricsListenPort != 0 {
+		opts = append(opts, WithMetricsListenPort(s.MetricsListenPort))
+	}
+
+	// WithPublicEndpoint replaces the http.Server, so it precedes the
+	// options which modify it
+	if s.PublicEndpoint {
+		opts = append(opts, WithPublicEndpoint())
+	}
+	if len(s.CertFilename) > 0 {
+		opts = append(opts, WithCertificate(s.CertFilename, s.KeyFilename))
+	}
+	if s.RequestClientCert {
+		opts = append(opts, WithRequestClientCert())
+	}
+	if s.RPCRequireClientCert {
+		opts = append(opts, WithRPCRequireClientCert())
+	}
+	if s.MetricsTLS {
+		opts = append(opts, WithMetricsTLS())
+	}
+	if len(s.MetricsCertFilename) > 0 {
+		opts = append(opts, WithMetricsCertificate(s.MetricsCertFilename, s.MetricsKeyFilename))
+	}
+	if len(s.SNICertificates) > 0 {
+		opts = append(opts, WithSNICertificates(s.SNICertificates))
+	}
+
+	if s.HTTPReadTimeout != 0 || s.HTTPWriteTimeout != 0 || s.HTTPIdleTimeout != 0 {
+		opts = append(opts, WithHTTPTimeouts(s.HTTPReadTimeout, s.HTTPWriteTimeout, s.HTTPIdleTimeout))
+	}
+	if s.RPCMaxConnectionAge != 0 {
+		opts = append(opts, WithRPCMaxConnectionAge(s.RPCMaxConnectionAge))
+	}
+	if s.MaxConnections != 0 {
+		opts = append(opts, WithMaxConnections(s.MaxConnections))
+	}
+	if s.MaxHeaderBytes != 0 {
+		opts = append(opts, WithMaxHeaderBytes(s.MaxHeaderBytes))
+	}
+
+	if len(s.CanonicalHost) > 0 {
+		opts = append(opts, WithCanonicalHost(s.CanonicalHost))
+	}
+	if s.Gzip {
+		opts = append(opts, WithGzip())
+	}
+	if s.ServerTiming {
+		opts = append(opts, WithServerTiming())
+	}
+	if len(s.RedactedMetadata) > 0 {
+		opts = append(opts, WithRedactedMetadata(s.RedactedMetadata...))
+	}
+	if s.HystrixStream {
+		opts = append(opts, WithHystrixStream())
+	}
+	if len(s.HystrixStreamOrigins) > 0 {
+		opts = append(opts, WithHystrixStreamOrigins(s.HystrixStreamOrigins...))
+	}
+	if s.RuntimeMetrics {
+		opts = append(opts, WithRuntimeMetrics())
+	}
+	if s.Minimal {
+		opts = append(opts, WithMinimal())
+	}
+	if s.Tracer {
+		opts = append(opts, WithTracer())
+	}
+	if len(s.ServiceName) > 0 {
+		opts = append(opts, WithServiceName(s.ServiceName))
+	}
+	if len(s.Environment) > 0 {
+		opts = append(opts, WithEnvironment(s.Environment))
+	}
+
+	return opts
+}
+
+// RunWithSettings validates s and, if it is valid, runs the server it
+// describes.  opts, which typically provide the handlers & logger, are
+// applied after s.
+func RunWithSettings(s Settings, opts ...Option) error {
+	if err := s.Validate(); err != nil {
+		return fmt.Errorf("invalid server settings: %w", err)
+	}
+
+	return Run(append(s.Options(), opts...)...)
+}
+
+// httpTimeouts are the non-zero timeouts of WithHTTPTimeouts
+type httpTimeouts struct {
+	read, write, idle time.Duration
+}
+
+func (t httpTimeouts) apply(srv *http.Server) {
+	if t.read > 0 {
+		srv.ReadTimeout = t.read
+	}
+	if t.write > 0 {
+		srv.WriteTimeout = t.write
+	}
+	if t.idle > 0 {
+		srv.IdleTimeout = t.idle
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	assert.NoError(t, Settings{}.Validate())
+
+	err := Settings{
+		HTTPListenPort:  70000,
+		CertFilename:    "server.crt",
+		MetricsTLS:      true,
+		HTTPReadTimeout: -time.Second,
+		Minimal:         true,
+		HystrixStream:   true,
+	}.Validate()
+	assert.ErrorContains(t, err, "httpPort 70000 is not a valid port")
+	assert.ErrorContains(t, err, "minimal and hystrixStream are mutually exclusive")
+	assert.ErrorContains(t, err, "cert and key must be provided together")
+	assert.ErrorContains(t, err, "httpReadTimeout may not be negative")
+
+	err = RunWithSettings(Settings{RPCListenPort: -1}, WithExitOnShutdown(false))
+	assert.ErrorContains(t, err, "invalid server settings")
+}
+
+func TestRunWithSettings(t *testing.T) {
+	port := freePort(t)
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	err := RunWithSettings(Settings{HTTPListenPort: port, HTTPWriteTimeout: 5 * time.Second},
+		WithLogger(zap.NewNop()),
+		WithHTTPServer(http.NotFoundHandler()),
+		WithShutdownSignal(stop, wg),
+		WithExitOnShutdown(false),
+	)
+	assert.NoError(t, err)
+
+	waitForListener(t, port)
+
+	close(stop)
+	wg.Wait()
+}
@@ -22,6 +22,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -32,6 +34,10 @@ import (
 	Handle the graceful shutdown of the server endpoints
 */
 
+// ErrShutdownTimeout is returned by Run when the servers did not
+// shut down within the wait time
+var ErrShutdownTimeout = errors.New("wait time for service shutdown has elapsed")
+
 type sourcetype int
 
 const (
@@ -40,43 +46,74 @@ const (
 	metricsServer
 	rpcServer
 	unknown
+	shutdownChannel  // the WithShutdownSignal channel was closed
+	contextCancelled // the WithShutdownContext context is done
 )
 
+// eventSource records why the server is stopping
 type eventSource struct {
 	source sourcetype
 	err    error
+	signal os.Signal // set when source is interrupt
 }
 
 func (t sourcetype) String() string {
-	sourcetypeNames := []string{"interrupt", "httpServer", "metricServer", "rpcServer", "unknown"}
+	sourcetypeNames := []string{"interrupt", "httpServer", "metricServer", "rpcServer", "unknown",
+		"shutdownChannel", "contextCancelled"}
 
 	return sourcetypeNames[t]
 }
 
-func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSource) {
-	cfg.logger.Info("termination event detected", zap.Error(evtSrc.err), zap.String("source", evtSrc.source.String()))
+// runShutdownHooks invokes each of the shutdown hooks in turn,
+// stopping early only if the shutdown wait time has elapsed
+func (cfg *Config) runShutdownHooks(ctx context.Context) {
+	for i, hook := range cfg.shutdownHooks {
+		if ctx.Err() != nil {
+			cfg.logger.Warn("wait time elapsed before all shutdown hooks were run",
+				zap.Int("hooksRemaining", len(cfg.shutdownHooks)-i))
+			return
+		}
+
+		if err := hook(ctx); err != nil {
+			cfg.logger.Error("shutdown hook failed", zap.Int("hook", i), zap.Error(err))
+		}
+	}
+}
+
+func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSource) error {
+	fields := []zap.Field{zap.Error(evtSrc.err), zap.String("source", evtSrc.source.String())}
+	if evtSrc.signal != nil {
+		fields = append(fields, zap.Stringer("signal", evtSrc.signal))
+	}
+	cfg.logger.Info("termination event detected", fields...)
 	waitDuration := 60 * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), waitDuration)
 	defer cancel()
 
+	// reject new requests while the hooks run & in-flight requests complete
+	cfg.drainer.Drain()
+
+	// stop publishing to any hystrix stream clients
+	if cfg.hystrixStreamHandler != nil {
+		cfg.hystrixStreamHandler.Stop()
+	}
+
+	cfg.runShutdownHooks(ctx)
+
 	waitEvents := 0
 
 	if evtSrc.source != httpServer && cfg.httpServer != nil {
 		waitEvents++
 		go func() {
-			if err := cfg.httpServer.Shutdown(ctx); err != nil {
+			err := cfg.httpServer.Shutdown(ctx)
+			if err != nil {
 				cfg.logger.Error("httpServer.Shutdown", zap.Error(err))
+			}
 
-				//				if cfg.wg != nil {
-				//					cfg.wg.Add(-1) // she's not going down on her own...
-				//				}
-
-				// if we're here (in performGracefulShutdown), don't re-initiate shutdown
-				// by sending on the errc chan !?
-				//errc <- eventSource{
-				//	err:    err,
-				//	source: httpServer,
-				//}
+			// the http go routine doesn't report a clean close, so report it here
+			errc <- eventSource{
+				err:    err,
+				source: httpServer,
 			}
 		}()
 	}
@@ -84,6 +121,9 @@ func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSo
 		waitEvents++
 		go func() {
 			cfg.rpcServer.GracefulStop()
+			errc <- eventSource{
+				source: rpcServer,
+			}
 		}()
 	}
 	if evtSrc.source != metricsServer && cfg.metricsServer != nil {
@@ -92,17 +132,10 @@ func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSo
 			ctx, cancel := context.WithTimeout(context.Background(), waitDuration)
 			defer cancel()
 
+			// the metrics go routine reports its own close, & its deferred
+			// wg.Done keeps the WaitGroup balanced, whether or not this fails
 			if err := cfg.metricsServer.Shutdown(ctx); err != nil {
 				cfg.logger.Error("metricsServer.Shutdown", zap.Error(err))
-
-				if cfg.wg != nil {
-					cfg.wg.Add(-1) // she's not going down on her own...
-				}
-
-				errc <- eventSource{
-					err:    err,
-					source: metricsServer,
-				}
 			}
 		}()
 	}
@@ -112,11 +145,14 @@ func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSo
 		select {
 		case <-time.After(waitDuration + 1*time.Second):
 			cfg.logger.Info("server shutdown complete")
-			os.Exit(1)
+			cfg.logStop(evtSrc, ErrShutdownTimeout)
+			return cfg.exit(1, ErrShutdownTimeout)
 
 		case <-ctx.Done():
 			cfg.logger.Warn("wait time for service shutdown has elapsed -- performing hard shutdown", zap.Error(ctx.Err()))
-			os.Exit(2)
+			err := fmt.Errorf("%w -- %s", ErrShutdownTimeout, ctx.Err())
+			cfg.logStop(evtSrc, err)
+			return cfg.exit(2, err)
 
 		case evt := <-errc:
 			waitEvents--
@@ -125,5 +161,18 @@ func (cfg *Config) performGracefulShutdown(errc chan eventSource, evtSrc eventSo
 		}
 	}
 
-	//	os.Exit(0)
+	cfg.logger.Info("server shutdown complete")
+	cfg.logStop(evtSrc, nil)
+
+	return nil
+}
+
+// exit terminates the process with the given code, unless
+// WithExitOnShutdown(false) was provided, in which case err is returned
+func (cfg *Config) exit(code int, err error) error {
+	if cfg.exitOnShutdown {
+		os.Exit(code)
+	}
+
+	return err
 }
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sniReloadInterval is how often a certificate's files are checked for
+// changes, so that each certificate can be rotated independently
+const sniReloadInterval = 10 * time.Second
+
+// CertKeyPair names the PEM files of a certificate & its private key
+type CertKeyPair struct {
+	CertFilename string `mapstructure:"cert" json:"cert" yaml:"cert"`
+	KeyFilename  string `mapstructure:"key" json:"key" yaml:"key" redact:"true"`
+}
+
+// WithSNICertificates serves, over HTTPS, the certificate of certs whose
+// key matches the server name the client requested (SNI), e.g.,
+// "api.example.com", or "*.example.com" for any single label.  Clients
+// requesting another name, or none, are served the certificate of
+// WithCertificate, which is required.  Each certificate is reloaded when
+// its files change, so that it can be rotated without a restart.
+func WithSNICertificates(certs map[string]CertKeyPair) Option {
+	return func(cfg *Config) error {
+		if cfg.sniCertificates == nil {
+			cfg.sniCertificates = make(map[string]CertKeyPair, len(certs))
+		}
+
+		for name, pair := range certs {
+			if len(name) == 0 {
+				return errors.New("SNI certificates require a server name")
+			}
+			if len(pair.CertFilename) == 0 || len(pair.KeyFilename) == 0 {
+				return fmt.Errorf("the SNI certificate of %s requires a cert and key", name)
+			}
+			cfg.sniCertificates[strings.ToLower(name)] = pair
+		}
+		cfg.Insecure = false
+
+		return nil
+	}
+}
+
+// sniCertificates selects a certificate by the client's server name
+type sniCertificates struct {
+	byName map[string]*reloadingCertificate
+	dflt   *reloadingCertificate
+}
+
+func newSNICertificates(logger *zap.Logger, dflt CertKeyPair, certs map[string]CertKeyPair) (*sniCertificates, error) {
+	if len(dflt.CertFilename) == 0 {
+		return nil, errors.New("WithSNICertificates requires a default certificate (WithCertificate)")
+	}
+
+	s := &sniCertificates{
+		byName: make(map[string]*reloadingCertificate, len(certs)),
+		dflt:   &reloadingCertificate{pair: dflt, logger: logger},
+	}
+	if _, err := s.dflt.certificate(); err != nil {
+		return nil, err
+	}
+
+	for name, pair := range certs {
+		c := &reloadingCertificate{pair: pair, logger: logger}
+		if _, err := c.certificate(); err != nil {
+			return nil, fmt.Errorf("loading the SNI certificate of %s: %w", name, err)
+		}
+		s.byName[name] = c
+	}
+
+	return s, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (s *sniCertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	if c, ok := s.byName[name]; ok {
+		return c.certificate()
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if c, ok := s.byName["*"+name[i:]]; ok {
+			return c.certificate()
+		}
+	}
+
+	return s.dflt.certificate()
+}
+
+// reloadingCertificate is a certificate which is reloaded when its files
+// are modified.  If reloading fails, e.g., part way through a rotation,
+// the previous certificate continues to be served.
+type reloadingCertificate struct {
+	pair    CertKeyPair
+	logger  *zap.Logger
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // of the most recently modified file of the pair
+	checked time.Time
+}
+
+func (c *reloadingCertificate) certificate() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cert != nil && time.Since(c.checked) < sniReloadInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := c.pair.modTime()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.LoadX509KeyPair(c.pair.CertFilename, c.pair.KeyFilename)
+	}
+	if err != nil {
+		if c.cert == nil {
+			return nil, err
+		}
+		c.logger.Warn("unable to reload certificate; continuing with the previous one",
+			zap.String("cert", c.pair.CertFilename), zap.Error(err))
+		return c.cert, nil
+	}
+
+	if c.cert != nil {
+		c.logger.Info("certificate reloaded", zap.String("cert", c.pair.CertFilename))
+	}
+	c.cert, c.modTime = &cert, modTime
+
+	return c.cert, nil
+}
+
+// modTime returns the modification time of the more recently modified file
+func (p CertKeyPair) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, filename := range []string{p.CertFilename, p.KeyFilename} {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
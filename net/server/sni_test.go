@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// noError stops the test if err is not nil
+func noError(t *testing.T, err error) {
+	t.Helper()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+// writeCertificate writes a self-signed certificate for commonName to dir
+func writeCertificate(t *testing.T, dir, commonName string) CertKeyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	noError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	noError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	noError(t, err)
+
+	pair := CertKeyPair{
+		CertFilename: filepath.Join(dir, commonName+".crt"),
+		KeyFilename:  filepath.Join(dir, commonName+".key"),
+	}
+	noError(t, os.WriteFile(pair.CertFilename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	noError(t, os.WriteFile(pair.KeyFilename, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return pair
+}
+
+func servedName(t *testing.T, s *sniCertificates, serverName string) string {
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	noError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	noError(t, err)
+
+	return leaf.Subject.CommonName
+}
+
+func TestSNICertificates(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newConfig(WithSNICertificates(map[string]CertKeyPair{
+		"API.example.com": writeCertificate(t, dir, "api.example.com"),
+		"*.example.org":   writeCertificate(t, dir, "wildcard.example.org"),
+	}))
+	assert.False(t, cfg.Insecure)
+
+	_, err := newSNICertificates(zap.NewNop(), CertKeyPair{}, cfg.sniCertificates)
+	assert.Error(t, err, "a default certificate is required")
+
+	s, err := newSNICertificates(zap.NewNop(), writeCertificate(t, dir, "default.example.net"), cfg.sniCertificates)
+	noError(t, err)
+
+	assert.Equal(t, "api.example.com", servedName(t, s, "api.example.com"))
+	assert.Equal(t, "api.example.com", servedName(t, s, "Api.Example.Com."))
+	assert.Equal(t, "wildcard.example.org", servedName(t, s, "www.example.org"))
+	assert.Equal(t, "default.example.net", servedName(t, s, "a.b.example.org"), "wildcards match a single label")
+	assert.Equal(t, "default.example.net", servedName(t, s, "unknown.example.com"))
+	assert.Equal(t, "default.example.net", servedName(t, s, ""))
+
+	// rotate one certificate: its replacement is served once the files
+	// are seen to have changed, while the others are unaffected
+	c := s.byName["api.example.com"]
+	rotated := writeCertificate(t, t.TempDir(), "rotated.example.com")
+	for _, f := range [][2]string{{rotated.CertFilename, c.pair.CertFilename}, {rotated.KeyFilename, c.pair.KeyFilename}} {
+		noError(t, os.Rename(f[0], f[1]))
+		noError(t, os.Chtimes(f[1], time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	}
+	assert.Equal(t, "api.example.com", servedName(t, s, "api.example.com"), "files are checked periodically")
+
+	c.checked = time.Time{}
+	assert.Equal(t, "rotated.example.com", servedName(t, s, "api.example.com"))
+	assert.Equal(t, "wildcard.example.org", servedName(t, s, "www.example.org"))
+
+	// a failed reload continues with the previous certificate
+	noError(t, os.WriteFile(c.pair.KeyFilename, []byte("garbage"), 0600))
+	noError(t, os.Chtimes(c.pair.KeyFilename, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+	c.checked = time.Time{}
+	assert.Equal(t, "rotated.example.com", servedName(t, s, "api.example.com"))
+}
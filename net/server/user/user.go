@@ -24,9 +24,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-)
 
-type key struct{}
+	"github.com/mchudgins/go/net/server/requestContext"
+)
 
 const (
 	// USERID is an HTTP header
@@ -36,11 +36,8 @@ const (
 var (
 	// NotFound returned when the USERID header is not in the request
 	NotFound error = fmt.Errorf("%s not found", USERID)
-	userID         = key{}
 )
 
-//type key struct{}
-
 // FromRequest gets the userid from an HTTP request
 func FromRequest(req *http.Request) (string, error) {
 	var err error
@@ -55,14 +52,12 @@ func FromRequest(req *http.Request) (string, error) {
 
 // FromContext extracts a user from a Context
 func FromContext(ctx context.Context) string {
-	val, ok := ctx.Value(userID).(string)
-	if ok {
-		return val
-	}
-	return ""
+	return requestContext.FromContext(ctx).User
 }
 
 // NewContext returns a new Context that carries the provided user id
 func NewContext(ctx context.Context, id string) context.Context {
-	return context.WithValue(ctx, userID, id)
+	return requestContext.Update(ctx, func(rc *requestContext.RequestContext) {
+		rc.User = id
+	})
 }
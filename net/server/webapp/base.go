@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package webapp
+
+import (
+	"net/http"
+
+	"github.com/justinas/alice"
+	"go.uber.org/zap"
+)
+
+// RouteRegistration is used with NewBase and registers
+// a service's routes (and any additional middleware) with the Base
+type RouteRegistration func(b *Base)
+
+// Base provides the router, middleware chain and common handlers
+// shared by the webapp servers.  Services embed a *Base and
+// supply only their routes.
+type Base struct {
+	logger  *zap.Logger
+	router  *http.ServeMux
+	chain   alice.Chain
+	handler http.Handler
+	routes  []Route
+
+	errorBody ErrorBody
+}
+
+// NewBase constructs a Base with the context logger installed
+// and then invokes routes to register the service's endpoints.
+func NewBase(logger *zap.Logger, routes RouteRegistration) *Base {
+	b := &Base{
+		logger: logger,
+		router: http.NewServeMux(),
+		chain:  alice.New(),
+
+		errorBody: DefaultErrorBody,
+	}
+
+	b.chain = b.chain.Append(b.contextLogger())
+
+	if routes != nil {
+		routes(b)
+	}
+
+	b.HandleNamed("site map", "GET "+RoutesPath, b.routesHandler())
+
+	b.handler = b.chain.ThenFunc(b.route)
+
+	return b
+}
+
+// Logger returns the Base's logger
+func (b *Base) Logger() *zap.Logger {
+	return b.logger
+}
+
+// Use appends middleware to the chain applied to every route.
+// It must be called from the RouteRegistration passed to NewBase.
+func (b *Base) Use(constructors ...alice.Constructor) {
+	b.chain = b.chain.Append(constructors...)
+}
+
+// SetErrorBody replaces DefaultErrorBody as the body of the 404 Not Found
+// and 405 Method Not Allowed responses for requests matching no route.
+// It must be called from the RouteRegistration passed to NewBase.
+func (b *Base) SetErrorBody(body ErrorBody) {
+	b.errorBody = body
+}
+
+// route dispatches r to its handler or, if no route matches, writes
+// a JSON error response in place of the router's plain text one
+func (b *Base) route(w http.ResponseWriter, r *http.Request) {
+	h, pattern := b.router.Handler(r)
+	if len(pattern) > 0 {
+		// the router, rather than h, serves the request, so that the
+		// pattern's wildcards (r.PathValue) are set
+		b.router.ServeHTTP(w, r)
+		return
+	}
+
+	// the router's handler decides between 404 & 405 (with its Allow header)
+	rw := &statusRecorder{header: make(http.Header)}
+	h.ServeHTTP(rw, r)
+	if rw.status < http.StatusBadRequest {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	if allow := rw.header.Values("Allow"); len(allow) > 0 {
+		w.Header()["Allow"] = allow
+	}
+	writeError(w, r, rw.status, b.errorBody)
+}
+
+// statusRecorder captures the status & headers written to it and
+// discards the body
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (rw *statusRecorder) Header() http.Header { return rw.header }
+
+func (rw *statusRecorder) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return len(data), nil
+}
+
+func (rw *statusRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+// Handle registers the handler for the given pattern
+func (b *Base) Handle(pattern string, h http.Handler) {
+	b.HandleNamed("", pattern, h)
+}
+
+// HandleFunc registers the handler function for the given pattern
+func (b *Base) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	b.HandleNamed("", pattern, http.HandlerFunc(h))
+}
+
+// HandleNamed registers the handler for the given pattern and
+// records the route, with its display name, in the site map
+func (b *Base) HandleNamed(name, pattern string, h http.Handler) {
+	b.router.Handle(pattern, h)
+	b.addRoute(name, pattern)
+}
+
+// RegisterRoute registers the handler for path and each of the given
+// methods (or all methods, if none are given).  The route-scoped
+// constructors wrap only this handler and run after the Base's chain,
+// e.g., to apply a tighter timeout or additional authorization.
+func (b *Base) RegisterRoute(path string, methods []string, h http.Handler, constructors ...alice.Constructor) {
+	h = alice.New(constructors...).Then(h)
+
+	if len(methods) == 0 {
+		b.Handle(path, h)
+		return
+	}
+
+	for _, method := range methods {
+		b.Handle(method+" "+path, h)
+	}
+}
+
+func (b *Base) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package webapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+func TestRateLimitIsApplied(t *testing.T) {
+	const burst = 3
+
+	b := NewBase(zap.NewNop(), func(b *Base) {
+		b.Use(RateLimit(0, burst))
+		b.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	for i := 0; i < burst; i++ {
+		rr := httptest.NewRecorder()
+		b.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code, "request %d should be within the burst", i)
+	}
+
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
+
+func TestRouteScopedRateLimit(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	b := NewBase(zap.NewNop(), func(b *Base) {
+		b.Use(RateLimit(0, 10))
+		b.RegisterRoute("/report", []string{http.MethodGet}, ok, RateLimit(0, 1))
+		b.RegisterRoute("/cheap", []string{http.MethodGet}, ok)
+	})
+
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		b.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/report"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/report"), "route limit should apply")
+	assert.Equal(t, http.StatusOK, get("/cheap"), "global limit should not yet apply")
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	b := NewBase(zap.NewNop(), func(b *Base) {
+		b.HandleNamed("widgets", "GET /widgets", http.NotFoundHandler())
+		b.HandleNamed("widgets", "POST /widgets", http.NotFoundHandler())
+		b.Handle("/other", http.NotFoundHandler())
+	})
+
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, RoutesPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var routes []Route
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &routes))
+	assert.Equal(t, []Route{
+		{Path: "/widgets", Methods: []string{"GET", "POST"}, Name: "widgets"},
+		{Path: "/other"},
+		{Path: RoutesPath, Methods: []string{"GET"}, Name: "site map"},
+	}, routes)
+}
+
+func TestUnmatchedRoutesReturnJSON(t *testing.T) {
+	b := NewBase(zap.NewNop(), func(b *Base) {
+		b.HandleFunc("GET /widgets", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/gadgets", nil)
+	r = r.WithContext(correlationID.NewContext(r.Context(), "abc-123"))
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"not found","requestID":"abc-123"}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	b.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/widgets", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Contains(t, rr.Header().Get("Allow"), http.MethodGet)
+	assert.JSONEq(t, `{"error":"method not allowed","requestID":""}`, rr.Body.String())
+
+	custom := NewBase(zap.NewNop(), func(b *Base) {
+		b.SetErrorBody(func(r *http.Request, status int) interface{} {
+			return map[string]int{"code": status}
+		})
+	})
+	rr = httptest.NewRecorder()
+	custom.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/gadgets", nil))
+	assert.JSONEq(t, `{"code":404}`, rr.Body.String())
+}
+
+func TestWildcardRoutes(t *testing.T) {
+	b := NewBase(zap.NewNop(), func(b *Base) {
+		b.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.PathValue("id")))
+		})
+	})
+
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders/42", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "42", rr.Body.String())
+}
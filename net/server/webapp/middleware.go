@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package webapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/justinas/alice"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/mchudgins/go/log"
+	"github.com/mchudgins/go/net/server/correlationID"
+)
+
+// contextLogger adds the per-request fields we care about to each log message
+func (b *Base) contextLogger() alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			ctxLogger := b.logger.With(zap.String(correlationID.RequestIDKey, correlationID.FromContext(ctx)))
+
+			ctx = log.NewContext(ctx, ctxLogger)
+			r = r.WithContext(ctx)
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit returns middleware which rejects requests with
+// 429 Too Many Requests once the limit & burst are exceeded
+func RateLimit(limit rate.Limit, burst int) alice.Constructor {
+	rl := rate.NewLimiter(limit, burst)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rl.Allow() {
+				h.ServeHTTP(w, r)
+			} else {
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		})
+	}
+}
+
+// ErrorBody returns the value, encoded as JSON, of the body of an error
+// response with the given status
+type ErrorBody func(r *http.Request, status int) interface{}
+
+// DefaultErrorBody returns the error, e.g., "not found", and the request's
+// correlation ID, as {"error": "not found", "requestID": "..."}
+func DefaultErrorBody(r *http.Request, status int) interface{} {
+	return map[string]string{
+		"error":                    strings.ToLower(http.StatusText(status)),
+		correlationID.RequestIDKey: correlationID.FromContext(r.Context()),
+	}
+}
+
+// writeError writes an error response with the given status and body
+func writeError(w http.ResponseWriter, r *http.Request, status int, body ErrorBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body(r, status)); err != nil {
+		log.FromContext(r.Context()).Debug("unable to write the error response", zap.Error(err))
+	}
+}
+
+// NotFoundHandler responds with 404 Not Found and a DefaultErrorBody
+func NotFoundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, DefaultErrorBody)
+	}
+}
+
+// MethodNotAllowedHandler responds with 405 Method Not Allowed and
+// a DefaultErrorBody
+func MethodNotAllowedHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusMethodNotAllowed, DefaultErrorBody)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024.  Mike Hudgins <mchudgins@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ *
+ */
+
+package webapp
+
+import (
+	"net/http"
+	"strings"
+
+	gsh "github.com/mchudgins/go/net/server/handler"
+)
+
+// RoutesPath is the path of the site map endpoint registered by NewBase
+const RoutesPath = "/_routes"
+
+// Route describes a registered endpoint
+type Route struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods,omitempty"`
+	Name    string   `json:"name,omitempty"`
+}
+
+// Routes returns the routes registered with the Base
+func (b *Base) Routes() []Route {
+	routes := make([]Route, len(b.routes))
+	copy(routes, b.routes)
+
+	return routes
+}
+
+// addRoute supplements the router with info for the site mapper.
+// ServeMux patterns take the form "[METHOD ][HOST]/[PATH]".
+func (b *Base) addRoute(name, pattern string) {
+	var method string
+	path := pattern
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		method = pattern[:i]
+		path = strings.TrimLeft(pattern[i:], " \t")
+	}
+
+	for i := range b.routes {
+		if b.routes[i].Path == path && b.routes[i].Name == name {
+			if len(method) > 0 {
+				b.routes[i].Methods = append(b.routes[i].Methods, method)
+			}
+			return
+		}
+	}
+
+	r := Route{Path: path, Name: name}
+	if len(method) > 0 {
+		r.Methods = []string{method}
+	}
+	b.routes = append(b.routes, r)
+}
+
+// routesHandler emits the site map as JSON
+func (b *Base) routesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = gsh.EncodeJSON(w, r, b.Routes(), false)
+	})
+}